@@ -0,0 +1,174 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveInterval is how often the concurrency controller evaluates throughput and adjusts concurrency
+	adaptiveInterval = 2 * time.Second
+	// adaptiveInitialConcurrency is the concurrency the controller starts with, before clamping to the bounds
+	adaptiveInitialConcurrency = 8
+)
+
+// concurrencyController tunes the limit of a semaphore using additive increase, multiplicative decrease (AIMD).
+// Each interval, concurrency is halved if any requests were throttled, increased by one if throughput did not drop,
+// and decreased by one if throughput dropped while latency rose.
+type concurrencyController struct {
+	sem *semaphore
+	min int
+	max int
+	log io.Writer
+
+	mutex            sync.Mutex
+	bytes            int64
+	requests         int
+	throttled        int
+	latency          time.Duration
+	lastThroughput   float64
+	lastLatency      time.Duration
+	lastWindowActive bool
+}
+
+// newConcurrencyController creates a controller that writes a message to log, if it is not nil, each time it changes
+// the concurrency
+func newConcurrencyController(min, max int, log io.Writer) *concurrencyController {
+	initial := adaptiveInitialConcurrency
+	if initial > max {
+		initial = max
+	}
+	if initial < min {
+		initial = min
+	}
+	return &concurrencyController{
+		sem: newSemaphore(initial),
+		min: min,
+		max: max,
+		log: log,
+	}
+}
+
+// run adjusts concurrency periodically until the context is done
+func (c *concurrencyController) run(ctx context.Context) {
+	ticker := time.NewTicker(adaptiveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.adjust(adaptiveInterval)
+		}
+	}
+}
+
+// recordRequest records the latency of opening a reader
+func (c *concurrencyController) recordRequest(latency time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requests++
+	c.latency += latency
+}
+
+// recordThrottled records a request that was throttled, which the storage client retries on its own
+func (c *concurrencyController) recordThrottled() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.throttled++
+}
+
+// recordBytes records bytes that have been downloaded
+func (c *concurrencyController) recordBytes(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.bytes += int64(n)
+}
+
+func (c *concurrencyController) adjust(interval time.Duration) {
+	c.mutex.Lock()
+	throughput := float64(c.bytes) / interval.Seconds()
+	var latency time.Duration
+	if c.requests > 0 {
+		latency = c.latency / time.Duration(c.requests)
+	}
+	throttled := c.throttled
+	active := c.bytes > 0 || c.requests > 0
+	lastThroughput, lastLatency, lastWindowActive := c.lastThroughput, c.lastLatency, c.lastWindowActive
+	c.bytes, c.requests, c.throttled, c.latency = 0, 0, 0, 0
+	c.lastThroughput, c.lastWindowActive = throughput, active
+	if latency > 0 {
+		c.lastLatency = latency
+	}
+	c.mutex.Unlock()
+
+	if !active {
+		return
+	}
+
+	current := c.sem.getLimit()
+	next := current
+	switch {
+	case throttled > 0:
+		next = current / 2
+	case !lastWindowActive || throughput >= lastThroughput*0.95:
+		next = current + 1
+	case lastLatency > 0 && latency > lastLatency*3/2:
+		next = current - 1
+	}
+	if next < c.min {
+		next = c.min
+	}
+	if next > c.max {
+		next = c.max
+	}
+	if next == current {
+		return
+	}
+
+	c.sem.setLimit(next)
+	if c.log != nil {
+		fmt.Fprintf(c.log, "concurrency %d -> %d (throughput=%.1fMiB/s, latency=%v, throttled=%d)\n", current, next, throughput/(1<<20), latency.Round(time.Millisecond), throttled)
+	}
+}
+
+// reader wraps a reader so that the bytes read from it are recorded
+func (c *concurrencyController) reader(reader io.ReadCloser) io.ReadCloser {
+	return &measuredReader{controller: c, reader: reader}
+}
+
+type measuredReader struct {
+	controller *concurrencyController
+	reader     io.ReadCloser
+}
+
+func (r *measuredReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.controller.recordBytes(n)
+	}
+	return n, err
+}
+
+func (r *measuredReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConcurrencyControllerAdjust(t *testing.T) {
+	c := newConcurrencyController(2, 10, nil)
+	if limit := c.sem.getLimit(); limit != 8 {
+		t.Fatalf("wrong initial limit: expected 8, got %d", limit)
+	}
+
+	// Steady throughput should increase concurrency additively, up to the maximum
+	for i := 0; i < 5; i++ {
+		c.recordRequest(10 * time.Millisecond)
+		c.recordBytes(1000)
+		c.adjust(time.Second)
+	}
+	if limit := c.sem.getLimit(); limit != 10 {
+		t.Fatalf("wrong limit after steady throughput: expected 10, got %d", limit)
+	}
+
+	// Throttling should decrease concurrency multiplicatively, down to the minimum
+	expected := []int{5, 2, 2}
+	for _, e := range expected {
+		c.recordRequest(10 * time.Millisecond)
+		c.recordThrottled()
+		c.adjust(time.Second)
+		if limit := c.sem.getLimit(); limit != e {
+			t.Fatalf("wrong limit after throttling: expected %d, got %d", e, limit)
+		}
+	}
+
+	// An idle interval should not change concurrency
+	c.adjust(time.Second)
+	if limit := c.sem.getLimit(); limit != 2 {
+		t.Fatalf("wrong limit after idle interval: expected 2, got %d", limit)
+	}
+}
+
+func TestConcurrencyControllerShouldDecreaseWhenThroughputDropsAndLatencyRises(t *testing.T) {
+	c := newConcurrencyController(1, 10, nil)
+	c.recordRequest(10 * time.Millisecond)
+	c.recordBytes(1000)
+	c.adjust(time.Second)
+	if limit := c.sem.getLimit(); limit != 9 {
+		t.Fatalf("wrong limit: expected 9, got %d", limit)
+	}
+
+	c.recordRequest(100 * time.Millisecond)
+	c.recordBytes(500)
+	c.adjust(time.Second)
+	if limit := c.sem.getLimit(); limit != 8 {
+		t.Fatalf("wrong limit: expected 8, got %d", limit)
+	}
+}
+
+func TestConcurrencyValue(t *testing.T) {
+	var value int
+	var auto bool
+	c := concurrency{value: &value, auto: &auto}
+	for _, tc := range []struct {
+		s             string
+		expectedValue int
+		expectedAuto  bool
+	}{
+		{s: "auto", expectedAuto: true},
+		{s: "4", expectedValue: 4},
+	} {
+		if err := c.Set(tc.s); err != nil {
+			t.Fatalf("set failed: %v", err)
+		}
+		if value != tc.expectedValue || auto != tc.expectedAuto {
+			t.Fatalf("wrong value for %q: got %d/%v", tc.s, value, auto)
+		}
+		if c.String() != tc.s {
+			t.Fatalf("wrong string: expected %q, got %q", tc.s, c.String())
+		}
+	}
+	if err := c.Set("lots"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+)
+
+const archiveZip = "zip"
+
+// archiveCompression maps each tar --archive format to the compression it uses
+var archiveCompression = map[string]string{
+	"tar":     file.CompressionNone,
+	"tar.gz":  file.CompressionGzip,
+	"tar.zst": file.CompressionZstd,
+}
+
+// defaultZipStoreTypes are the content types of data that is usually already compressed
+var defaultZipStoreTypes = []string{
+	"image/*", "video/*", "audio/*",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd", "application/x-bzip2",
+	"application/x-xz", "application/x-7z-compressed", "application/vnd.rar",
+}
+
+// stdout is where objects are written by --to-stdout, and where an archive is written when its path is -
+var stdout io.Writer = os.Stdout
+
+// createArchiveOutput creates the file that an archive is written to, where - is stdout
+var createArchiveOutput = func(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// archiveCopier is a copier that must be closed to finish writing the archive
+type archiveCopier interface {
+	file.Copier
+	io.Closer
+}
+
+// openArchive creates the archive that objects are written into
+func (r *runner) openArchive() (archiveCopier, error) {
+	output, err := createArchiveOutput(r.archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive %s: %v", r.archivePath, err)
+	}
+	if r.archive == archiveZip {
+		return file.NewZipCopier(output, r.outputDirectory, r.zipStoreTypes), nil
+	}
+	copier, err := file.NewTarCopier(output, r.outputDirectory, archiveCompression[r.archive])
+	if err != nil {
+		output.Close()
+		return nil, fmt.Errorf("failed to create archive %s: %v", r.archivePath, err)
+	}
+	return copier, nil
+}
+
+// nopWriteCloser is a writer that does nothing when closed, so that stdout stays open
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
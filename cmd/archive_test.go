@@ -0,0 +1,161 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+type archiveBuffer struct {
+	bytes.Buffer
+}
+
+func (b *archiveBuffer) Close() error {
+	return nil
+}
+
+func TestCommandWithArchiveShouldWriteTar(t *testing.T) {
+	updated := time.Date(2022, 2, 3, 4, 5, 6, 0, time.UTC)
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{
+				{Name: "prefix/foo", Updated: updated},
+				{Name: "prefix/bar/baz", Updated: updated},
+			}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	output := &archiveBuffer{}
+	var outputPath string
+	originalCreateArchiveOutput := createArchiveOutput
+	defer func() { createArchiveOutput = originalCreateArchiveOutput }()
+	createArchiveOutput = func(path string) (io.WriteCloser, error) {
+		outputPath = path
+		return output, nil
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "-", "--archive", "tar.gz"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if outputPath != "-" {
+		t.Fatalf("wrong archive path: expected %q, got %q", "-", outputPath)
+	}
+
+	gzipReader, err := gzip.NewReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+	entries := map[string]string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !header.ModTime.Equal(updated) {
+			t.Fatalf("wrong modification time for %s: expected %v, got %v", header.Name, updated, header.ModTime)
+		}
+		content, _ := io.ReadAll(tarReader)
+		entries[header.Name] = string(content)
+	}
+	if len(entries) != 2 || entries["foo"] != "prefix/foo" || entries["bar/baz"] != "prefix/bar/baz" {
+		t.Fatalf("wrong entries: %v", entries)
+	}
+}
+
+func TestCommandWithArchiveShouldWriteZip(t *testing.T) {
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{
+				{Name: "prefix/foo.txt", ContentType: "text/plain"},
+				{Name: "prefix/bar.jpg", ContentType: "image/jpeg"},
+			}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	output := &archiveBuffer{}
+	originalCreateArchiveOutput := createArchiveOutput
+	defer func() { createArchiveOutput = originalCreateArchiveOutput }()
+	createArchiveOutput = func(path string) (io.WriteCloser, error) {
+		return output, nil
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "out.zip", "--archive", "zip"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	methods := map[string]uint16{}
+	for _, f := range reader.File {
+		methods[f.Name] = f.Method
+	}
+	if len(methods) != 2 || methods["foo.txt"] != zip.Deflate || methods["bar.jpg"] != zip.Store {
+		t.Fatalf("wrong entries: %v", methods)
+	}
+}
+
+func TestConfigureArchive(t *testing.T) {
+	r := runner{archive: "tar"}
+	if err := r.configure(NewCommand(), []string{"bucket", "prefix", "-"}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+	if r.archivePath != "-" || r.outputDirectory != "" {
+		t.Fatalf("wrong archive path %q and output directory %q", r.archivePath, r.outputDirectory)
+	}
+	if r.log != os.Stderr {
+		t.Fatalf("messages should be written to stderr when the archive is written to stdout")
+	}
+
+	for _, tc := range []struct {
+		runner *runner
+		args   []string
+	}{
+		{runner: &runner{archive: "rar"}, args: []string{"bucket", "prefix", "out.rar"}},
+		{runner: &runner{archive: "tar"}, args: []string{"bucket", "prefix", "out1.tar", "out2.tar"}},
+		{runner: &runner{archive: "tar", indexFile: "index.jsonl"}, args: []string{"bucket", "prefix", "out.tar"}},
+	} {
+		r := tc.runner
+		if err := r.configure(NewCommand(), tc.args); err == nil {
+			t.Fatalf("expected error for --archive %s with %v", r.archive, tc.args)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checksum
+
+import (
+	"hash"
+	"hash/crc32"
+)
+
+// castagnoliReversed is the reversed form of the Castagnoli polynomial used by Google Cloud Storage
+const castagnoliReversed = 0x82f63b78
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// NewCRC32C creates a new hash computing the CRC32 checksum using the Castagnoli polynomial
+func NewCRC32C() hash.Hash32 {
+	return crc32.New(castagnoliTable)
+}
+
+// CombineCRC32C returns the CRC32C checksum of the concatenation of two blocks of data, given the checksum of each
+// block and the length of the second block.
+// This is the same algorithm as crc32_combine in zlib, which works by applying len2 zero bytes to crc1 using
+// repeated squaring of a matrix that represents the CRC operator for a single zero bit.
+func CombineCRC32C(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+
+	var even, odd [32]uint32
+
+	// Put operator for one zero bit in odd
+	odd[0] = castagnoliReversed
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+
+	// Put operator for two zero bits in even, then four zero bits in odd
+	gf2MatrixSquare(&even, &odd)
+	gf2MatrixSquare(&odd, &even)
+
+	// Apply len2 zeros to crc1 (the first square puts the operator for one zero byte, eight zero bits, in even)
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i++ {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+		vec >>= 1
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat *[32]uint32) {
+	for n := 0; n < 32; n++ {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checksum
+
+import (
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+func TestCombineCRC32C(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	expected := crc32.Checksum(data, castagnoliTable)
+
+	for _, split := range []int{0, 1, 7, 4096, 65537, len(data)} {
+		t.Run(fmt.Sprintf("split at %d", split), func(tt *testing.T) {
+			crc1 := crc32.Checksum(data[:split], castagnoliTable)
+			crc2 := crc32.Checksum(data[split:], castagnoliTable)
+			actual := CombineCRC32C(crc1, crc2, int64(len(data)-split))
+			if actual != expected {
+				tt.Fatalf("wrong checksum: expected %08x, got %08x", expected, actual)
+			}
+		})
+	}
+}
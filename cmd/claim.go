@@ -0,0 +1,239 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+type claimState int
+
+const (
+	// claimAcquired means this worker now holds the lease on the object
+	claimAcquired claimState = iota
+	// claimHeld means another worker holds an unexpired lease on the object
+	claimHeld
+	// claimDone means the object has already been downloaded by some worker
+	claimDone
+)
+
+// claimer coordinates a fleet of workers downloading the same objects by storing lease and completion markers in a
+// coordination prefix. Markers are created using generation preconditions, so only one worker can hold the lease on
+// an object at a time. A lease that is not renewed within the lease duration, measured from the time the marker was
+// last updated, may be taken over by another worker.
+type claimer struct {
+	bucketName    string
+	prefix        string
+	workerID      string
+	leaseDuration time.Duration
+}
+
+// lease represents a claim held by this worker on an object
+type lease struct {
+	claimer          *claimer
+	objectName       string
+	objectGeneration int64
+
+	mutex      sync.Mutex
+	generation int64
+	lost       bool
+}
+
+func (c *claimer) leaseMarkerName(objectName string) string {
+	return c.prefix + "leases/" + objectName
+}
+
+// doneMarkerName returns the name of the marker recording that a generation of an object has been downloaded, so that
+// the object is downloaded again if it is replaced by a new generation
+func (c *claimer) doneMarkerName(objectName string, generation int64) string {
+	return fmt.Sprintf("%sdone/%s@%d", c.prefix, objectName, generation)
+}
+
+// isMarker returns true if the object is one of the claimer's own markers
+func (c *claimer) isMarker(objectName string) bool {
+	return strings.HasPrefix(objectName, c.prefix)
+}
+
+// claim attempts to acquire the lease on a generation of an object
+func (c *claimer) claim(ctx context.Context, objectName string, generation int64) (claimState, *lease, error) {
+	if done, err := c.isDone(ctx, objectName, generation); err != nil || done {
+		return claimDone, nil, err
+	}
+
+	markerName := c.leaseMarkerName(objectName)
+	conditions := storage.Conditions{DoesNotExist: true}
+	for {
+		info, err := c.writeLeaseMarker(ctx, markerName, conditions)
+		if err == nil {
+			// The previous holder may have completed the object just before releasing its lease
+			if done, err := c.isDone(ctx, objectName, generation); err != nil || done {
+				_ = storageClient.DeleteObject(ctx, c.bucketName, markerName, storage.Conditions{GenerationMatch: info.Generation})
+				return claimDone, nil, err
+			}
+			return claimAcquired, &lease{claimer: c, objectName: objectName, objectGeneration: generation, generation: info.Generation}, nil
+		}
+		if !errors.Is(err, storage.ErrPreconditionFailed) {
+			return claimHeld, nil, fmt.Errorf("failed to create lease marker for %s: %v", objectName, err)
+		}
+		if !conditions.DoesNotExist {
+			// Another worker took over the expired lease first
+			return claimHeld, nil, nil
+		}
+
+		existing, err := storageClient.StatObject(ctx, c.bucketName, markerName)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			// The lease was released after our attempt to create it, so try again
+			continue
+		}
+		if err != nil {
+			return claimHeld, nil, fmt.Errorf("failed to get lease marker for %s: %v", objectName, err)
+		}
+		if time.Since(existing.Updated) < c.leaseDuration {
+			return claimHeld, nil, nil
+		}
+
+		// The lease has expired, so try to take it over from the worker that held it
+		conditions = storage.Conditions{GenerationMatch: existing.Generation}
+	}
+}
+
+func (c *claimer) isDone(ctx context.Context, objectName string, generation int64) (bool, error) {
+	_, err := storageClient.StatObject(ctx, c.bucketName, c.doneMarkerName(objectName, generation))
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get completion marker for %s: %v", objectName, err)
+	}
+	return true, nil
+}
+
+func (c *claimer) writeLeaseMarker(ctx context.Context, markerName string, conditions storage.Conditions) (storage.ObjectInfo, error) {
+	return storageClient.WriteObject(ctx, c.bucketName, markerName, strings.NewReader(c.workerID), conditions)
+}
+
+// keepAlive renews the lease periodically until the returned function is called.
+// If the lease is lost to another worker, cancel is called.
+func (l *lease) keepAlive(ctx context.Context, cancel context.CancelFunc) func() {
+	stop := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(l.claimer.leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.renew(ctx); err != nil {
+					if errors.Is(err, storage.ErrPreconditionFailed) {
+						cancel()
+						return
+					}
+					_, _ = fmt.Fprintf(os.Stderr, "WARNING: failed to renew lease on %s: %v\n", l.objectName, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+func (l *lease) renew(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	info, err := l.claimer.writeLeaseMarker(ctx, l.claimer.leaseMarkerName(l.objectName), storage.Conditions{GenerationMatch: l.generation})
+	if err != nil {
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			l.lost = true
+		}
+		return err
+	}
+	l.generation = info.Generation
+	return nil
+}
+
+// isLost returns true if another worker took over the lease
+func (l *lease) isLost() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.lost
+}
+
+// complete records that the object has been downloaded and then releases the lease
+func (l *lease) complete(ctx context.Context) error {
+	doneMarkerName := l.claimer.doneMarkerName(l.objectName, l.objectGeneration)
+	if _, err := storageClient.WriteObject(ctx, l.claimer.bucketName, doneMarkerName, strings.NewReader(l.claimer.workerID), storage.Conditions{}); err != nil {
+		return fmt.Errorf("failed to create completion marker for %s: %v", l.objectName, err)
+	}
+	return l.release(ctx)
+}
+
+// release deletes the lease marker so that another worker can claim the object
+func (l *lease) release(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	err := storageClient.DeleteObject(ctx, l.claimer.bucketName, l.claimer.leaseMarkerName(l.objectName), storage.Conditions{GenerationMatch: l.generation})
+	if err != nil && !errors.Is(err, storage.ErrPreconditionFailed) && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to release lease on %s: %v", l.objectName, err)
+	}
+	return nil
+}
+
+// claimAndDownloadObject downloads an object only if this worker is able to claim it, returning true if the object
+// should be tried again later because another worker holds the lease on it
+func (r *runner) claimAndDownloadObject(ctx context.Context, obj *storage.ObjectInfo) (bool, error) {
+	state, l, err := r.claimer.claim(ctx, obj.Name, obj.Generation)
+	if err != nil {
+		return false, err
+	}
+	switch state {
+	case claimDone:
+		return false, nil
+	case claimHeld:
+		return true, nil
+	}
+
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopKeepAlive := l.keepAlive(downloadCtx, cancel)
+	err = r.downloadAndProcessObject(downloadCtx, obj)
+	stopKeepAlive()
+
+	if l.isLost() {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: lost lease on %s to another worker\n", obj.Name)
+		return true, nil
+	}
+	if err != nil {
+		_ = l.release(ctx)
+		return false, err
+	}
+	return false, l.complete(ctx)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// newMockBucket returns a MockClient backed by an in-memory bucket that honors generation preconditions
+func newMockBucket(objects map[string]storage.ObjectInfo) *storage.MockClient {
+	mutex := sync.Mutex{}
+	var generation int64
+	return &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			mutex.Lock()
+			defer mutex.Unlock()
+			var result []storage.ObjectInfo
+			for _, objectInfo := range objects {
+				result = append(result, objectInfo)
+			}
+			return result
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+		StatObjectFunc: func(bucketName, objectName string) (storage.ObjectInfo, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if objectInfo, exists := objects[objectName]; exists {
+				return objectInfo, nil
+			}
+			return storage.ObjectInfo{}, storage.ErrObjectNotExist
+		},
+		WriteObjectFunc: func(bucketName, objectName string, data []byte, conditions storage.Conditions) (storage.ObjectInfo, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			existing, exists := objects[objectName]
+			if conditions.DoesNotExist && exists {
+				return storage.ObjectInfo{}, storage.ErrPreconditionFailed
+			}
+			if conditions.GenerationMatch != 0 && (!exists || existing.Generation != conditions.GenerationMatch) {
+				return storage.ObjectInfo{}, storage.ErrPreconditionFailed
+			}
+			generation++
+			objects[objectName] = storage.ObjectInfo{Name: objectName, Size: int64(len(data)), Generation: generation, Updated: time.Now()}
+			return objects[objectName], nil
+		},
+		DeleteObjectFunc: func(bucketName, objectName string, conditions storage.Conditions) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			existing, exists := objects[objectName]
+			if !exists {
+				return storage.ErrObjectNotExist
+			}
+			if conditions.GenerationMatch != 0 && existing.Generation != conditions.GenerationMatch {
+				return storage.ErrPreconditionFailed
+			}
+			delete(objects, objectName)
+			return nil
+		},
+	}
+}
+
+func TestClaimShouldBeExclusive(t *testing.T) {
+	objects := map[string]storage.ObjectInfo{}
+	storageClient = newMockBucket(objects)
+	ctx := context.Background()
+
+	worker1 := &claimer{bucketName: "bucket", prefix: "claims/", workerID: "worker1", leaseDuration: time.Minute}
+	worker2 := &claimer{bucketName: "bucket", prefix: "claims/", workerID: "worker2", leaseDuration: time.Minute}
+
+	state, l, err := worker1.claim(ctx, "prefix/foo", 1)
+	if err != nil || state != claimAcquired {
+		t.Fatalf("worker1 should acquire the lease: state=%v, err=%v", state, err)
+	}
+
+	state, _, err = worker2.claim(ctx, "prefix/foo", 1)
+	if err != nil || state != claimHeld {
+		t.Fatalf("worker2 should see the lease as held: state=%v, err=%v", state, err)
+	}
+
+	if err := l.complete(ctx); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if _, exists := objects["claims/leases/prefix/foo"]; exists {
+		t.Fatalf("lease marker should have been deleted")
+	}
+
+	state, _, err = worker2.claim(ctx, "prefix/foo", 1)
+	if err != nil || state != claimDone {
+		t.Fatalf("worker2 should see the object as done: state=%v, err=%v", state, err)
+	}
+}
+
+func TestClaimShouldTakeOverExpiredLease(t *testing.T) {
+	objects := map[string]storage.ObjectInfo{}
+	storageClient = newMockBucket(objects)
+	ctx := context.Background()
+
+	worker1 := &claimer{bucketName: "bucket", prefix: "claims/", workerID: "worker1", leaseDuration: time.Minute}
+	worker2 := &claimer{bucketName: "bucket", prefix: "claims/", workerID: "worker2", leaseDuration: time.Minute}
+
+	_, l1, err := worker1.claim(ctx, "prefix/foo", 1)
+	if err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+
+	// Simulate worker1 failing to renew its lease
+	marker := objects["claims/leases/prefix/foo"]
+	marker.Updated = time.Now().Add(-2 * time.Minute)
+	objects["claims/leases/prefix/foo"] = marker
+
+	state, l2, err := worker2.claim(ctx, "prefix/foo", 1)
+	if err != nil || state != claimAcquired {
+		t.Fatalf("worker2 should take over the lease: state=%v, err=%v", state, err)
+	}
+
+	if err := l1.renew(ctx); err == nil || !l1.isLost() {
+		t.Fatalf("worker1 should have lost the lease")
+	}
+	if err := l2.renew(ctx); err != nil {
+		t.Fatalf("worker2 renew failed: %v", err)
+	}
+}
+
+func TestCommandWithClaimPrefixShouldNotDownloadCompletedObjects(t *testing.T) {
+	objects := map[string]storage.ObjectInfo{
+		"prefix/foo": {Name: "prefix/foo", Generation: 1},
+		"prefix/bar": {Name: "prefix/bar", Generation: 1},
+	}
+	storageClient = newMockBucket(objects)
+
+	mutex := sync.Mutex{}
+	copied := map[string]int{}
+	fileCopier = &file.MockCopier{
+		CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			copied[path]++
+			return 0, nil
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		command := NewCommand()
+		command.SetArgs([]string{"bucket", "prefix", "path", "--claim-prefix", "prefix/.claims", "--worker-id", "worker"})
+		if err := command.Execute(); err != nil {
+			t.Fatalf("execute failed: %v", err)
+		}
+	}
+
+	if len(copied) != 2 || copied["path/foo"] != 1 || copied["path/bar"] != 1 {
+		t.Fatalf("each object should have been copied once: %v", copied)
+	}
+	if _, exists := objects["prefix/.claims/done/prefix/foo@1"]; !exists {
+		t.Fatalf("missing completion marker")
+	}
+
+	// A new generation of an object has not been downloaded yet, even though the previous generation has
+	objects["prefix/foo"] = storage.ObjectInfo{Name: "prefix/foo", Generation: 2}
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "path", "--claim-prefix", "prefix/.claims", "--worker-id", "worker"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if copied["path/foo"] != 2 || copied["path/bar"] != 1 {
+		t.Fatalf("only the new generation should have been copied again: %v", copied)
+	}
+}
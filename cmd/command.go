@@ -18,11 +18,18 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/ratelimit"
 	"github.com/brianpursley/gsdownload/version"
+	"hash/fnv"
+	"io"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/brianpursley/gsdownload/cmd/storage"
 	"github.com/spf13/cobra"
@@ -34,16 +41,89 @@ var (
 )
 
 type runner struct {
-	bucketName      string
-	prefix          string
-	outputDirectory string
+	bucketName        string
+	prefix            string
+	outputDirectory   string
+	outputDirectories []string
+
+	dryRun              bool
+	notFoundIsError     bool
+	startAfter          string
+	endBefore           string
+	noRecursive         bool
+	maxDepth            int
+	listShards          int
+	shardIndex          int
+	shardCount          int
+	maxConcurrent       int
+	autoConcurrent      bool
+	minAutoConcurrent   int
+	maxAutoConcurrent   int
+	largeThreshold      byteSize
+	maxConcurrentLarge  int
+	order               string
+	maxObjects          int
+	maxBytes            byteSize
+	newest              int
+	limitMode           string
+	samplePercent       percentage
+	sampleCount         int
+	seed                int64
+	claimPrefix         string
+	leaseDuration       time.Duration
+	workerID            string
+	slicedThreshold     byteSize
+	slices              int
+	limitRate           byteRate
+	limitBurst          byteSize
+	stallTimeout        time.Duration
+	hedgeRatio          float64
+	timeout             time.Duration
+	objectTimeout       time.Duration
+	retries             int
+	minFreeSpace        byteSize
+	stripe              string
+	indexFile           string
+	archive             string
+	zipStoreTypes       []string
+	toStdout            bool
+	execPipe            string
+	onObject            string
+	hookConcurrency     int
+	hookErrors          string
+	decompress          string
+	extract             bool
+	extractMaxBytes     byteSize
+	extractMaxFiles     int
+	extractMaxRatio     float64
+	extractDelete       bool
+	mirror              bool
+	maxDelete           int
+	deleteAfterDownload bool
+	archivePath         string
+	destinationBucket   string
+	destinationPrefix   string
+	verbose             bool
+	version             bool
+
+	claimer           *claimer
+	limiter           *ratelimit.Limiter
+	controller        *concurrencyController
+	throughput        throughputTracker
+	sampler           *sampler
+	watchdog          *spaceWatchdog
+	objectDirectories map[string]string
+	copier            file.Copier
+	log               io.Writer
+	hookSem           *semaphore
+	skippedPrefixes   []string
+	truncated         bool
+}
 
-	dryRun          bool
-	notFoundIsError bool
-	maxConcurrent   int
-	maxObjects      int
-	verbose         bool
-	version         bool
+type objectResult struct {
+	obj      *storage.ObjectInfo
+	deferred bool
+	err      error
 }
 
 // NewCommand creates a new instance of the command
@@ -51,16 +131,72 @@ func NewCommand() *cobra.Command {
 	r := runner{}
 
 	var cmd = &cobra.Command{
-		Use:          "gsdownload <bucket> <prefix> <output directory>",
-		Short:        "Bulk download objects from a Google Cloud Storage bucket",
-		Long:         `A utility for downloading objects from a Google Cloud Storage bucket`,
+		Use:   "gsdownload <bucket> <prefix> [<output directory>... | gs://<bucket>/<prefix>]",
+		Short: "Bulk download objects from a Google Cloud Storage bucket",
+		Long: `A utility for downloading objects from a Google Cloud Storage bucket
+
+To download from a bucket named upload or help, put -- before the bucket name, after any flags.`,
 		SilenceUsage: true,
-		RunE:         r.run,
+		// Without this, cobra would treat the bucket name as an unknown subcommand
+		Args: cobra.ArbitraryArgs,
+		RunE: r.run,
 	}
+	cmd.CompletionOptions.DisableDefaultCmd = true
+	cmd.AddCommand(newUploadCommand())
 
 	cmd.Flags().BoolVar(&r.dryRun, "dry-run", false, "Display a list of the files that will be downloaded and then exit without downloading them")
-	cmd.Flags().IntVar(&r.maxConcurrent, "max-concurrent", 8, "The maximum number of concurrent downloads (0=unlimited)")
+	cmd.Flags().StringVar(&r.startAfter, "start-after", "", "Only download objects whose full name is lexicographically after this value")
+	cmd.Flags().StringVar(&r.endBefore, "end-before", "", "Only download objects whose full name is lexicographically before this value")
+	cmd.Flags().BoolVar(&r.noRecursive, "no-recursive", false, "Only download objects directly beneath the prefix (same as --max-depth 1)")
+	cmd.Flags().IntVar(&r.maxDepth, "max-depth", 0, "The maximum number of levels beneath the prefix to download objects from (0=unlimited)")
+	cmd.Flags().IntVar(&r.listShards, "list-shards", 1, "The number of key ranges to list concurrently when finding objects (0 or 1=sequential)")
+	cmd.Flags().IntVar(&r.shardIndex, "shard-index", 0, "The zero-based index of the shard of objects to download (requires --shard-count)")
+	cmd.Flags().IntVar(&r.shardCount, "shard-count", 0, "The number of shards to divide objects into by hashing their names (0=no sharding)")
+	r.maxConcurrent = 8
+	cmd.Flags().Var(&concurrency{value: &r.maxConcurrent, auto: &r.autoConcurrent}, "max-concurrent", "The maximum number of concurrent downloads, or auto to tune it based on throughput, latency and throttling (0=unlimited)")
+	cmd.Flags().IntVar(&r.minAutoConcurrent, "auto-min-concurrent", 1, "The minimum number of concurrent downloads when --max-concurrent is auto")
+	cmd.Flags().IntVar(&r.maxAutoConcurrent, "auto-max-concurrent", 64, "The maximum number of concurrent downloads when --max-concurrent is auto")
+	cmd.Flags().Var(&r.largeThreshold, "large-object-threshold", "Download objects at least this large, such as 100MiB, in a separate pool limited by --max-concurrent-large (0=disabled)")
+	cmd.Flags().IntVar(&r.maxConcurrentLarge, "max-concurrent-large", 2, "The maximum number of concurrent downloads of objects above --large-object-threshold (0=unlimited)")
+	cmd.Flags().StringVar(&r.order, "order", orderName, "The order in which downloads are started: name, size-asc, size-desc or updated (oldest first)")
 	cmd.Flags().IntVar(&r.maxObjects, "max-objects", 1000, "The maximum number of objects to download (0=unlimited)")
+	cmd.Flags().Var(&r.maxBytes, "max-bytes", "The maximum total size of objects to download, such as 10GiB (0=unlimited)")
+	cmd.Flags().IntVar(&r.newest, "newest", 0, "Only download the most recently updated N objects (0=all)")
+	cmd.Flags().StringVar(&r.limitMode, "limit-mode", limitModeError, "What to do when --max-objects or --max-bytes is exceeded: error, or truncate to download objects up to the limit")
+	cmd.Flags().Var(&r.samplePercent, "sample", "Only download a random sample of this percentage of objects, such as 1% (0=all)")
+	cmd.Flags().IntVar(&r.sampleCount, "sample-count", 0, "Only download a random sample of this number of objects (0=all)")
+	cmd.Flags().Int64Var(&r.seed, "seed", 0, "The seed used to select objects when sampling, so the same objects can be selected again (default is random)")
+	cmd.Flags().StringVar(&r.claimPrefix, "claim-prefix", "", "A prefix in the bucket where lease markers are stored so multiple workers can cooperatively download the same objects (requires write access)")
+	cmd.Flags().DurationVar(&r.leaseDuration, "lease-duration", 5*time.Minute, "How long a lease on an object remains valid without being renewed before another worker can take it over")
+	cmd.Flags().StringVar(&r.workerID, "worker-id", "", "The identity recorded in lease markers created by this worker (default <hostname>-<pid>)")
+	cmd.Flags().Var(&r.slicedThreshold, "sliced-threshold", "Download objects at least this large in concurrent slices, such as 1GiB (0=disabled)")
+	cmd.Flags().IntVar(&r.slices, "slices", 4, "The number of slices to download concurrently for objects above --sliced-threshold")
+	cmd.Flags().Var(&r.limitRate, "limit-rate", "The maximum aggregate download rate across all concurrent downloads, such as 50MiB/s (0=unlimited)")
+	cmd.Flags().Var(&r.limitBurst, "limit-burst", "The number of bytes that can be downloaded in a burst above --limit-rate (default is one second's worth)")
+	cmd.Flags().DurationVar(&r.stallTimeout, "stall-timeout", 0, "Start a second read of the remaining range of an object if no data is received for this long, and fail if the second read also stalls (0=disabled)")
+	cmd.Flags().Float64Var(&r.hedgeRatio, "hedge-ratio", 0, "Start a second read of the remaining range of an object if its throughput falls below the median throughput divided by this value (0=disabled)")
+	cmd.Flags().DurationVar(&r.timeout, "timeout", 0, "The maximum amount of time for the whole run, including listing (0=unlimited)")
+	cmd.Flags().DurationVar(&r.objectTimeout, "object-timeout", 0, "The maximum amount of time to read and write each object (0=unlimited)")
+	cmd.Flags().IntVar(&r.retries, "retries", 0, "The number of times to retry an object that exceeded --object-timeout (throttled requests are already retried by the storage client)")
+	cmd.Flags().Var(&r.minFreeSpace, "min-free-space", "Pause downloads while free space in the output directory is below this amount, such as 10GiB (0=disabled)")
+	cmd.Flags().StringVar(&r.stripe, "stripe", stripeRoundRobin, "How to distribute objects across multiple output directories: round-robin, free-space or hash (of the object name)")
+	cmd.Flags().StringVar(&r.indexFile, "index-file", "", "A file to write with one JSON line per object, mapping its name to the path where it was saved (default <first output directory>/.gsdownload-index.jsonl with multiple output directories)")
+	cmd.Flags().StringVar(&r.archive, "archive", "", "Write objects into a single archive at the output path, or - for stdout, instead of separate files: tar, tar.gz, tar.zst or zip")
+	cmd.Flags().StringSliceVar(&r.zipStoreTypes, "zip-store", defaultZipStoreTypes, "Content types, which may use wildcards such as image/*, of objects that are stored without compression when --archive is zip")
+	cmd.Flags().BoolVar(&r.toStdout, "to-stdout", false, "Write the content of the objects to stdout, one after another in name order, instead of to an output directory")
+	cmd.Flags().StringVar(&r.execPipe, "exec-pipe", "", "Run a shell command for each object with its content on stdin, instead of saving it to an output directory (the object name is in $GSDOWNLOAD_OBJECT)")
+	cmd.Flags().StringVar(&r.onObject, "on-object", "", "Run a shell command after each object is downloaded, where {path}, {name}, {size}, {generation}, {crc32c} and {content_type} are replaced with quoted values (also in $GSDOWNLOAD_PATH, $GSDOWNLOAD_OBJECT, etc.)")
+	cmd.Flags().IntVar(&r.hookConcurrency, "hook-concurrency", 4, "The maximum number of --on-object commands to run concurrently (0=unlimited)")
+	cmd.Flags().StringVar(&r.hookErrors, "hook-errors", hookErrorsFail, "What to do when an --on-object command fails: fail, which treats it the same as a failed download, or ignore")
+	cmd.Flags().StringVar(&r.decompress, "decompress", decompressNone, "Decompress objects while downloading them, removing the .gz or .zst extension: auto, gzip, zstd or none (objects are detected by their extension or content encoding)")
+	cmd.Flags().BoolVar(&r.extract, "extract", false, "Unpack objects that are .tar, .tar.gz, .tgz, .tar.zst or .zip archives into a directory named after the object, without the extension")
+	cmd.Flags().Var(&r.extractMaxBytes, "extract-max-bytes", "The maximum total size of the files extracted from each archive, such as 10GiB (0=unlimited)")
+	cmd.Flags().IntVar(&r.extractMaxFiles, "extract-max-files", 100000, "The maximum number of files extracted from each archive (0=unlimited)")
+	cmd.Flags().Float64Var(&r.extractMaxRatio, "extract-max-ratio", 100, "The maximum total size of the files extracted from each archive relative to the size of the archive (0=unlimited)")
+	cmd.Flags().BoolVar(&r.extractDelete, "extract-delete", false, "Delete each archive after it has been successfully extracted")
+	cmd.Flags().BoolVar(&r.mirror, "mirror", false, "After downloading, delete files beneath the output directories that do not correspond to any object matching the filters")
+	cmd.Flags().IntVar(&r.maxDelete, "max-delete", 100, "Fail without deleting anything if --mirror would delete more than this many files (0=unlimited)")
+	cmd.Flags().BoolVar(&r.deleteAfterDownload, "delete-after-download", false, "Delete each object from the bucket once its local copy has been verified against its checksum, unless the object has been replaced in the meantime")
 	cmd.Flags().BoolVar(&r.notFoundIsError, "error", false, "Exit with non-zero exit code if no objects were found matching the specified prefix")
 	cmd.Flags().BoolVarP(&r.verbose, "verbose", "v", false, "Include additional information about each object that is downloaded")
 	cmd.Flags().BoolVar(&r.version, "version", false, "Print version information and exit")
@@ -69,34 +205,305 @@ func NewCommand() *cobra.Command {
 }
 
 func (r *runner) configure(cmd *cobra.Command, args []string) error {
-	if err := cobra.ExactArgs(3)(cmd, args); err != nil {
+	if r.toStdout || r.execPipe != "" {
+		// Objects are streamed instead of being saved, so there is no output directory
+		if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+			return err
+		}
+	} else if err := cobra.MinimumNArgs(3)(cmd, args); err != nil {
 		return err
 	}
 
 	r.bucketName = args[0]
 	r.prefix = args[1]
-	r.outputDirectory = args[2]
+	if len(args) > 2 {
+		r.outputDirectory = args[2]
+		r.outputDirectories = args[2:]
+	}
+	r.copier = fileCopier
+	r.log = os.Stdout
+
+	if len(r.outputDirectories) > 0 && isBucketURL(r.outputDirectory) {
+		if len(r.outputDirectories) > 1 {
+			return fmt.Errorf("a %s destination cannot be used with multiple output directories", bucketURLScheme)
+		}
+		if r.archive != "" || r.extract || r.indexFile != "" || r.minFreeSpace > 0 || r.limitRate > 0 || (r.decompress != "" && r.decompress != decompressNone) {
+			return fmt.Errorf("a %s destination cannot be used with --archive, --extract, --index-file, --min-free-space, --limit-rate or --decompress", bucketURLScheme)
+		}
+		var err error
+		r.destinationBucket, r.destinationPrefix, err = parseBucketURL(r.outputDirectory)
+		if err != nil {
+			return err
+		}
+		// Copying within overlapping prefixes would rewrite objects onto themselves or onto other source objects
+		sourcePrefix := normalizePrefix(r.prefix)
+		r.destinationPrefix = normalizePrefix(r.destinationPrefix)
+		if r.destinationBucket == r.bucketName &&
+			(strings.HasPrefix(r.destinationPrefix, sourcePrefix) || strings.HasPrefix(sourcePrefix, r.destinationPrefix)) {
+			return fmt.Errorf("the destination must not overlap the source")
+		}
+		// Objects are copied by the server, so nothing is written locally
+		r.copier = nil
+		r.outputDirectory = ""
+		r.outputDirectories = nil
+	}
+
+	if r.toStdout || r.execPipe != "" {
+		if r.toStdout && r.execPipe != "" {
+			return fmt.Errorf("--to-stdout cannot be used with --exec-pipe")
+		}
+		if r.archive != "" || r.indexFile != "" {
+			return fmt.Errorf("--to-stdout and --exec-pipe cannot be used with --archive or --index-file")
+		}
+		if r.execPipe != "" {
+			// The commands write to stdout, so keep the log out of their output
+			r.copier = file.NewExecCopier(r.execPipe, r.outputDirectory)
+			r.log = os.Stderr
+		}
+	}
+
+	if r.onObject != "" {
+		if r.toStdout || r.execPipe != "" || r.archive != "" {
+			return fmt.Errorf("--on-object cannot be used with --to-stdout, --exec-pipe or --archive")
+		}
+		if err := validateHook(r.onObject); err != nil {
+			return err
+		}
+	}
+
+	switch r.hookErrors {
+	case "", hookErrorsFail, hookErrorsIgnore:
+	default:
+		return fmt.Errorf("--hook-errors must be one of: %s, %s", hookErrorsFail, hookErrorsIgnore)
+	}
+
+	switch r.decompress {
+	case "", decompressNone, decompressAuto, decompressGzip, decompressZstd:
+	default:
+		return fmt.Errorf("--decompress must be one of: %s, %s, %s, %s", decompressAuto, decompressGzip, decompressZstd, decompressNone)
+	}
+
+	if r.extract {
+		if r.toStdout || r.execPipe != "" || r.archive != "" {
+			return fmt.Errorf("--extract cannot be used with --to-stdout, --exec-pipe or --archive")
+		}
+		if r.extractMaxBytes < 0 || r.extractMaxFiles < 0 || r.extractMaxRatio < 0 {
+			return fmt.Errorf("--extract-max-bytes, --extract-max-files and --extract-max-ratio must be greater than or equal to zero")
+		}
+	} else if r.extractDelete {
+		return fmt.Errorf("--extract-delete requires --extract")
+	}
+
+	if r.mirror {
+		if r.toStdout || r.execPipe != "" || r.archive != "" || r.destinationBucket != "" {
+			return fmt.Errorf("--mirror cannot be used with --to-stdout, --exec-pipe, --archive or a %s destination", bucketURLScheme)
+		}
+		// Files for objects that were not selected would be deleted
+		if r.samplePercent > 0 || r.sampleCount > 0 || r.newest > 0 || r.shardCount > 0 || r.limitMode == limitModeTruncate {
+			return fmt.Errorf("--mirror cannot be used with --sample, --sample-count, --newest, --shard-count or --limit-mode %s", limitModeTruncate)
+		}
+		if r.maxDelete < 0 {
+			return fmt.Errorf("--max-delete must be greater than or equal to zero")
+		}
+	}
+
+	if r.deleteAfterDownload {
+		// The checksum of the local copy must match the object's checksum for it to be deleted
+		if r.toStdout || r.execPipe != "" || r.archive != "" || (r.decompress != "" && r.decompress != decompressNone) {
+			return fmt.Errorf("--delete-after-download cannot be used with --to-stdout, --exec-pipe, --archive or --decompress")
+		}
+	}
+
+	if r.hookConcurrency < 0 {
+		return fmt.Errorf("--hook-concurrency must be greater than or equal to zero")
+	}
+	r.hookSem = newSemaphore(r.hookConcurrency)
+
+	if r.toStdout {
+		// Data that has been written to stdout can't be taken back, and objects must be written in name order
+		if r.retries > 0 || r.claimPrefix != "" {
+			return fmt.Errorf("--to-stdout cannot be used with --retries or --claim-prefix")
+		}
+		if r.order != "" && r.order != orderName {
+			return fmt.Errorf("--to-stdout cannot be used with --order %s", r.order)
+		}
+		r.copier = file.NewWriterCopier(stdout)
+		r.log = os.Stderr
+		r.maxConcurrent = 1
+		r.autoConcurrent = false
+		r.largeThreshold = 0
+	}
+
+	if r.archive != "" {
+		if _, ok := archiveCompression[r.archive]; !ok && r.archive != archiveZip {
+			return fmt.Errorf("--archive must be one of: tar, tar.gz, tar.zst, zip")
+		}
+		if len(r.outputDirectories) > 1 {
+			return fmt.Errorf("--archive cannot be used with multiple output directories")
+		}
+		if r.indexFile != "" {
+			return fmt.Errorf("--archive cannot be used with --index-file")
+		}
+		r.archivePath = r.outputDirectory
+		if r.archivePath == "-" {
+			// The archive is written to stdout, so keep messages out of it
+			r.log = os.Stderr
+		}
+		// Objects are saved as entries named by their path relative to the root of the archive
+		r.outputDirectory = ""
+		r.outputDirectories = nil
+	}
+
+	seen := map[string]bool{}
+	for _, dir := range r.outputDirectories {
+		if seen[filepath.Clean(dir)] {
+			return fmt.Errorf("output directories must be distinct")
+		}
+		seen[filepath.Clean(dir)] = true
+	}
+
+	switch r.stripe {
+	case "", stripeRoundRobin, stripeFreeSpace, stripeHash:
+	default:
+		return fmt.Errorf("--stripe must be one of: %s, %s, %s", stripeRoundRobin, stripeFreeSpace, stripeHash)
+	}
+
+	if r.indexFile == "" && len(r.outputDirectories) > 1 {
+		r.indexFile = filepath.Join(r.outputDirectory, ".gsdownload-index.jsonl")
+	}
+
+	if r.maxDepth < 0 {
+		return fmt.Errorf("--max-depth must be greater than or equal to zero")
+	}
+
+	if r.noRecursive {
+		if r.maxDepth > 1 {
+			return fmt.Errorf("--no-recursive cannot be used with --max-depth greater than one")
+		}
+		r.maxDepth = 1
+	}
+
+	if r.listShards < 0 {
+		return fmt.Errorf("--list-shards must be greater than or equal to zero")
+	}
+
+	if r.shardCount < 0 {
+		return fmt.Errorf("--shard-count must be greater than or equal to zero")
+	}
+
+	if r.shardIndex < 0 || (r.shardCount > 0 && r.shardIndex >= r.shardCount) || (r.shardCount == 0 && r.shardIndex != 0) {
+		return fmt.Errorf("--shard-index must be greater than or equal to zero and less than --shard-count")
+	}
 
 	if r.maxConcurrent < 0 {
 		return fmt.Errorf("--max-concurrent must be greater than or equal to zero")
 	}
 
+	if r.maxConcurrentLarge < 0 {
+		return fmt.Errorf("--max-concurrent-large must be greater than or equal to zero")
+	}
+
+	switch r.order {
+	case "", orderName, orderSizeAscending, orderSizeDescending, orderUpdated:
+	default:
+		return fmt.Errorf("--order must be one of: %s, %s, %s, %s", orderName, orderSizeAscending, orderSizeDescending, orderUpdated)
+	}
+
+	if r.autoConcurrent {
+		if r.minAutoConcurrent < 1 || r.maxAutoConcurrent < r.minAutoConcurrent {
+			return fmt.Errorf("--auto-min-concurrent must be at least one and no more than --auto-max-concurrent")
+		}
+		var log io.Writer
+		if r.verbose {
+			log = r.log
+		}
+		r.controller = newConcurrencyController(r.minAutoConcurrent, r.maxAutoConcurrent, log)
+	}
+
 	if r.maxObjects < 0 {
 		return fmt.Errorf("--max-objects must be greater than or equal to zero")
 	}
 
-	if !strings.HasSuffix(r.prefix, "/") {
-		r.prefix = r.prefix + "/"
+	if r.newest < 0 {
+		return fmt.Errorf("--newest must be greater than or equal to zero")
 	}
-	if r.prefix == "/" {
-		r.prefix = ""
+
+	if r.sampleCount < 0 {
+		return fmt.Errorf("--sample-count must be greater than or equal to zero")
+	}
+
+	if r.samplePercent > 0 || r.sampleCount > 0 {
+		if r.samplePercent > 0 && r.sampleCount > 0 {
+			return fmt.Errorf("--sample cannot be used with --sample-count")
+		}
+		if !cmd.Flags().Changed("seed") {
+			r.seed = time.Now().UnixNano()
+		}
+		r.sampler = &sampler{seed: r.seed, percent: float64(r.samplePercent), count: r.sampleCount}
+	}
+
+	switch r.limitMode {
+	case "", limitModeError, limitModeTruncate:
+	default:
+		return fmt.Errorf("--limit-mode must be one of: %s, %s", limitModeError, limitModeTruncate)
+	}
+
+	r.prefix = normalizePrefix(r.prefix)
+
+	if r.slices < 0 {
+		return fmt.Errorf("--slices must be greater than or equal to zero")
+	}
+
+	if r.stallTimeout < 0 {
+		return fmt.Errorf("--stall-timeout must be greater than or equal to zero")
+	}
+
+	if r.hedgeRatio < 0 {
+		return fmt.Errorf("--hedge-ratio must be greater than or equal to zero")
+	}
+
+	if r.timeout < 0 || r.objectTimeout < 0 {
+		return fmt.Errorf("--timeout and --object-timeout must be greater than or equal to zero")
+	}
+
+	if r.retries < 0 {
+		return fmt.Errorf("--retries must be greater than or equal to zero")
+	}
+
+	if r.limitRate > 0 {
+		r.limiter = ratelimit.NewLimiter(int64(r.limitRate), int64(r.limitBurst))
+	}
+
+	if r.claimPrefix != "" {
+		if r.leaseDuration <= 0 {
+			return fmt.Errorf("--lease-duration must be greater than zero")
+		}
+		if r.workerID == "" {
+			hostname, _ := os.Hostname()
+			r.workerID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+		claimPrefix := strings.TrimPrefix(r.claimPrefix, "/")
+		if !strings.HasSuffix(claimPrefix, "/") {
+			claimPrefix = claimPrefix + "/"
+		}
+		r.claimer = &claimer{
+			bucketName:    r.bucketName,
+			prefix:        claimPrefix,
+			workerID:      r.workerID,
+			leaseDuration: r.leaseDuration,
+		}
+	}
+
+	r.startAfter = strings.TrimPrefix(r.startAfter, "/")
+	r.endBefore = strings.TrimPrefix(r.endBefore, "/")
+	if r.startAfter != "" && r.endBefore != "" && r.startAfter >= r.endBefore {
+		return fmt.Errorf("--start-after must be lexicographically less than --end-before")
 	}
-	r.prefix = strings.TrimPrefix(r.prefix, "/")
 
 	return nil
 }
 
-func (r *runner) run(cmd *cobra.Command, args []string) error {
+func (r *runner) run(cmd *cobra.Command, args []string) (err error) {
 	if r.version {
 		fmt.Println(version.Version)
 		return nil
@@ -106,98 +513,440 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	err := storageClient.Connect(cmd.Context())
+	ctx := cmd.Context()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	if r.archivePath != "" && !r.dryRun {
+		archive, openErr := r.openArchive()
+		if openErr != nil {
+			return openErr
+		}
+		r.copier = archive
+		defer func() {
+			if closeErr := archive.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed to finish writing archive: %v", closeErr)
+			}
+		}()
+	}
+
+	err = r.download(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %v: %v", r.timeout, err)
+	}
+	return err
+}
+
+func (r *runner) download(ctx context.Context) error {
+	err := storageClient.Connect(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create storage client: %v", err)
 	}
 	defer storageClient.Close()
 
-	objects, err := r.getObjects(cmd.Context())
+	objects, err := r.getObjects(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get objects: %v", err)
 	}
 
+	if r.dryRun || r.verbose {
+		if r.sampler != nil {
+			r.logf("(sampled with --seed %d)\n", r.seed)
+		}
+		for _, name := range r.skippedPrefixes {
+			r.logf("%s (skipped, exceeds maximum depth)\n", name)
+		}
+		if r.truncated {
+			r.logf("(remaining objects skipped, exceeds --max-objects or --max-bytes)\n")
+		}
+	}
+
 	if r.notFoundIsError && len(objects) == 0 {
 		return fmt.Errorf("no objects found")
 	}
 
-	var sem chan bool
-	if r.maxConcurrent > 0 {
-		sem = make(chan bool, r.maxConcurrent)
+	if r.controller != nil && !r.dryRun {
+		if r.verbose {
+			r.logf("concurrency %d (auto)\n", r.controller.sem.getLimit())
+		}
+		controllerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go r.controller.run(controllerCtx)
+	}
+
+	if err := r.planDirectories(objects); err != nil {
+		return err
+	}
+
+	if r.extract {
+		if err := r.checkExtractDirectories(objects); err != nil {
+			return err
+		}
+	}
+
+	if r.indexFile != "" && !r.dryRun {
+		if err := r.writeIndex(objects); err != nil {
+			return err
+		}
+	}
+
+	if reporter, ok := r.copier.(file.SpaceReporter); ok && !r.dryRun {
+		// Fail early instead of running out of space partway through
+		if err := r.checkFreeSpace(reporter, objects); err != nil {
+			return err
+		}
+		if r.minFreeSpace > 0 {
+			r.watchdog = &spaceWatchdog{reporter: reporter, paths: r.outputDirectories, minFree: int64(r.minFreeSpace)}
+			watchdogCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go r.watchdog.run(watchdogCtx)
+		}
+	}
+
+	sortObjects(objects, r.order)
+
+	pending := objects
+	for {
+		deferred, err := r.downloadObjects(ctx, pending)
+		if err != nil {
+			return err
+		}
+		if len(deferred) == 0 {
+			break
+		}
+
+		// Other workers hold leases on some objects, so check back later in case they fail to complete them
+		if r.verbose {
+			r.logf("waiting for %d objects leased by other workers\n", len(deferred))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.leaseDuration / 2):
+		}
+		pending = deferred
+	}
+
+	if r.mirror {
+		return r.mirrorOutputDirectories(objects)
+	}
+	return nil
+}
+
+// downloadObjects downloads objects concurrently and returns the objects that were deferred because another worker
+// holds a lease on them
+func (r *runner) downloadObjects(ctx context.Context, objects []*storage.ObjectInfo) ([]*storage.ObjectInfo, error) {
+	sem := newSemaphore(r.maxConcurrent)
+	if r.controller != nil {
+		sem = r.controller.sem
+	}
+
+	// Large objects are downloaded in their own pool, so they neither starve nor are starved by small objects
+	var small, large []*storage.ObjectInfo
+	for _, obj := range objects {
+		if r.largeThreshold > 0 && obj.Size >= int64(r.largeThreshold) {
+			large = append(large, obj)
+		} else {
+			small = append(small, obj)
+		}
+	}
+
+	resultChan := make(chan objectResult)
+	r.dispatchObjects(ctx, small, sem, resultChan)
+	r.dispatchObjects(ctx, large, newSemaphore(r.maxConcurrentLarge), resultChan)
+
+	var deferred []*storage.ObjectInfo
+	for range objects {
+		result := <-resultChan
+		if result.err != nil {
+			return nil, result.err
+		}
+		if result.deferred {
+			deferred = append(deferred, result.obj)
+		}
 	}
 
-	errorChan := make(chan error)
+	return deferred, nil
+}
+
+// dispatchObjects processes objects in order, limiting concurrency using a semaphore and sending the result for each
+// object to a channel
+func (r *runner) dispatchObjects(ctx context.Context, objects []*storage.ObjectInfo, sem *semaphore, resultChan chan<- objectResult) {
 	go func() {
 		for _, obj := range objects {
-			if sem != nil {
-				sem <- true
-			}
+			sem.acquire()
 			go func(obj *storage.ObjectInfo) {
-				if sem != nil {
-					defer func() { <-sem }()
-				}
-				if r.dryRun {
-					r.printObject(obj.Name, obj.Size)
-					errorChan <- nil
-				} else {
-					errorChan <- r.downloadObject(cmd.Context(), obj.Name)
-				}
+				defer sem.release()
+				deferred, err := r.processObject(ctx, obj)
+				resultChan <- objectResult{obj: obj, deferred: deferred, err: err}
 			}(obj)
 		}
 	}()
+}
 
-	for range objects {
-		err := <-errorChan
-		if err != nil {
-			return err
+func (r *runner) processObject(ctx context.Context, obj *storage.ObjectInfo) (bool, error) {
+	if r.dryRun {
+		r.printObject(obj.Name, obj.Size)
+		return false, nil
+	}
+	if r.watchdog != nil {
+		if err := r.watchdog.wait(ctx); err != nil {
+			return false, err
 		}
 	}
+	if r.claimer != nil {
+		return r.claimAndDownloadObject(ctx, obj)
+	}
+	return false, r.downloadAndProcessObject(ctx, obj)
+}
 
+// downloadAndProcessObject downloads an object, then verifies the local copy if the object is to be deleted, extracts it
+// if it is an archive, runs the --on-object command for it and finally deletes the object
+func (r *runner) downloadAndProcessObject(ctx context.Context, obj *storage.ObjectInfo) error {
+	if err := r.downloadObjectWithRetries(ctx, obj); err != nil {
+		if r.deleteAfterDownload && errors.Is(err, storage.ErrObjectNotExist) {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s was skipped because it was replaced or deleted after it was listed\n", obj.Name)
+			return nil
+		}
+		return err
+	}
+	deleteAfterDownload := r.deleteAfterDownload
+	if deleteAfterDownload && !r.isVerifiable(obj) {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s was not deleted because it has Content-Encoding %s, so its local copy can't be verified\n", obj.Name, obj.ContentEncoding)
+		deleteAfterDownload = false
+	}
+	if deleteAfterDownload {
+		// Verify before extracting, which may delete the local copy
+		if err := r.verifyLocalCopy(obj); err != nil {
+			return err
+		}
+	}
+	if r.extract {
+		if err := r.extractObject(obj); err != nil {
+			return err
+		}
+	}
+	if r.onObject != "" {
+		if err := r.runHook(ctx, obj); err != nil {
+			if r.hookErrors != hookErrorsIgnore {
+				return err
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
+		}
+	}
+	if deleteAfterDownload {
+		return r.deleteDownloadedObject(ctx, obj)
+	}
 	return nil
 }
 
 func (r *runner) getObjects(ctx context.Context) ([]*storage.ObjectInfo, error) {
 	var objects []*storage.ObjectInfo
-	err := storageClient.VisitObjects(ctx, r.bucketName, r.prefix, func(objectInfo storage.ObjectInfo) error {
+	var byteCount int64
+	query := storage.Query{
+		Prefix:      r.prefix,
+		StartOffset: r.startAfter,
+		EndOffset:   r.endBefore,
+	}
+	err := r.visitObjects(ctx, query, func(objectInfo storage.ObjectInfo) error {
+		if r.claimer != nil && r.claimer.isMarker(objectInfo.Name) {
+			// Skip the markers used to coordinate with other workers
+			return nil
+		}
+		if objectInfo.IsPrefix {
+			r.skippedPrefixes = append(r.skippedPrefixes, objectInfo.Name)
+			return nil
+		}
 		if strings.HasSuffix(objectInfo.Name, "/") {
 			// Skip directories
 			return nil
 		}
+		if objectInfo.Name == r.startAfter {
+			// StartOffset is inclusive, but --start-after is not
+			return nil
+		}
+		if r.shardCount > 0 && getShardForObject(objectInfo.Name, r.shardCount) != r.shardIndex {
+			return nil
+		}
+		if r.sampler != nil && !r.sampler.keep(&objectInfo) {
+			return nil
+		}
 		objects = append(objects, &objectInfo)
-		if r.maxObjects > 0 && len(objects) > r.maxObjects {
-			return fmt.Errorf("exceeded the maximum number of objects")
+		byteCount += objectInfo.Size
+		if r.newest == 0 && r.sampleCount == 0 {
+			if err := r.exceedsLimits(len(objects), byteCount); err != nil {
+				if r.limitMode != limitModeTruncate {
+					return err
+				}
+				if r.isListedInOrder() {
+					return errLimitReached
+				}
+			}
 		}
 		return nil
 	})
-	return objects, err
+	if err != nil && !errors.Is(err, errLimitReached) {
+		return nil, err
+	}
+	if r.sampler != nil {
+		objects = append(objects, r.sampler.sampled()...)
+	}
+
+	// Shards are listed concurrently, so restore the order that a sequential listing would have produced
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	sort.Strings(r.skippedPrefixes)
+
+	return r.selectObjects(objects)
+}
+
+func (r *runner) visitObjects(ctx context.Context, query storage.Query, visit func(objectInfo storage.ObjectInfo) error) error {
+	if r.maxDepth > 0 {
+		return storage.VisitObjectsToDepth(ctx, storageClient, r.bucketName, query, r.listShards, r.maxDepth, visit)
+	}
+	return storage.VisitObjectsParallel(ctx, storageClient, r.bucketName, query, r.listShards, visit)
 }
 
-func (r *runner) downloadObject(ctx context.Context, objectName string) error {
-	reader, err := storageClient.ReadObject(ctx, r.bucketName, objectName)
+// getShardForObject deterministically assigns an object to one of shardCount shards by hashing its name
+func getShardForObject(name string, shardCount int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int(h.Sum64() % uint64(shardCount))
+}
+
+func (r *runner) downloadObject(ctx context.Context, obj *storage.ObjectInfo) error {
+	if r.destinationBucket != "" {
+		return r.copyObjectToBucket(ctx, obj)
+	}
+	if compression := r.getCompressionForObject(obj); compression != "" {
+		return r.downloadObjectDecompressed(ctx, obj, compression)
+	}
+	if slicedCopier, ok := r.copier.(file.SlicedCopier); ok && r.isSliced(obj) {
+		return r.downloadObjectSliced(ctx, obj, slicedCopier)
+	}
+
+	// The whole content of an object with a content encoding is sent for any range, so it can't be hedged
+	hedged := (r.stallTimeout > 0 || r.hedgeRatio > 0) && obj.ContentEncoding == ""
+
+	start := time.Now()
+	var reader io.ReadCloser
+	var err error
+	if r.deleteAfterDownload || hedged {
+		// The listed generation is what gets verified and deleted, and what a hedged read resumes, so make sure that is
+		// what is downloaded
+		reader, err = r.readObjectRange(ctx, obj, 0, -1)
+	} else {
+		reader, err = r.readObject(ctx, obj.Name)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create new reader for %s: %v", objectName, err)
+		return fmt.Errorf("failed to create new reader for %s: %w", obj.Name, err)
+	}
+	if hedged {
+		reader = r.newHedgedReader(ctx, obj, reader)
 	}
 	defer reader.Close()
 
-	path := r.getPathForObject(objectName)
-	bytes, err := fileCopier.CopyToFile(path, reader)
+	bytes, err := r.copyObject(ctx, obj, reader)
 	if err != nil {
-		return fmt.Errorf("failed writing to file %s: %v", objectName, err)
+		return fmt.Errorf("failed writing to file %s: %v", obj.Name, err)
 	}
+	r.throughput.record(bytes, time.Since(start))
 
-	r.printObject(objectName, bytes)
+	r.printObject(obj.Name, bytes)
 	return nil
 }
 
+// copyObject copies an object's content to its path, along with its attributes and context if the copier supports them
+func (r *runner) copyObject(ctx context.Context, obj *storage.ObjectInfo, reader io.Reader) (int64, error) {
+	path := r.getPathForObject(obj.Name)
+	if contextCopier, ok := r.copier.(file.ContextCopier); ok {
+		return contextCopier.CopyToFileWithContext(ctx, path, reader, file.Attributes{Name: obj.Name, ModTime: obj.Updated, ContentType: obj.ContentType})
+	}
+	if attributesCopier, ok := r.copier.(file.AttributesCopier); ok {
+		return attributesCopier.CopyToFileWithAttributes(path, reader, file.Attributes{Name: obj.Name, ModTime: obj.Updated, ContentType: obj.ContentType})
+	}
+	return r.copier.CopyToFile(path, reader)
+}
+
+// readObject opens a reader for an object's content
+func (r *runner) readObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := storageClient.ReadObject(r.observeThrottling(ctx), r.bucketName, objectName)
+	return r.wrapReader(ctx, reader, time.Since(start), err)
+}
+
+// readObjectRange opens a reader for a range of an object's content
+func (r *runner) readObjectRange(ctx context.Context, obj *storage.ObjectInfo, offset, length int64) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := storageClient.ReadObjectRange(r.observeThrottling(ctx), r.bucketName, obj.Name, obj.Generation, offset, length)
+	return r.wrapReader(ctx, reader, time.Since(start), err)
+}
+
+// observeThrottling returns a context that reports throttled requests to the concurrency controller, if there is one
+func (r *runner) observeThrottling(ctx context.Context) context.Context {
+	if r.controller == nil {
+		return ctx
+	}
+	return storage.WithThrottleObserver(ctx, r.controller.recordThrottled)
+}
+
+// wrapReader applies the rate limit to a newly opened reader and records its statistics for the concurrency
+// controller, if there is one
+func (r *runner) wrapReader(ctx context.Context, reader io.ReadCloser, latency time.Duration, err error) (io.ReadCloser, error) {
+	if r.controller != nil {
+		r.controller.recordRequest(latency)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.limiter != nil {
+		reader = r.limiter.Reader(ctx, reader)
+	}
+	if r.controller != nil {
+		reader = r.controller.reader(reader)
+	}
+	return reader, nil
+}
+
 func (r *runner) getPathForObject(name string) string {
+	if r.destinationBucket != "" {
+		return bucketURLScheme + r.destinationBucket + "/" + r.getDestinationObjectName(name)
+	}
 	nameWithoutPrefix := strings.TrimPrefix(name, r.prefix)
-	return filepath.Join(r.outputDirectory, nameWithoutPrefix)
+	if compression := r.getCompressionForName(name); compression != "" {
+		nameWithoutPrefix = strings.TrimSuffix(nameWithoutPrefix, compressionExtensions[compression])
+	}
+	return filepath.Join(r.getDirectoryForObject(name), nameWithoutPrefix)
+}
+
+// normalizePrefix returns a prefix that ends with a slash and does not start with one, or an empty string for the
+// root of the bucket
+func normalizePrefix(prefix string) string {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+	if prefix == "/" {
+		prefix = ""
+	}
+	return strings.TrimPrefix(prefix, "/")
 }
 
 func (r *runner) printObject(name string, size int64) {
 	if r.verbose {
-		fmt.Printf("%s --> %s (size=%d)\n", name, r.getPathForObject(name), size)
+		r.logf("%s --> %s (size=%d)\n", name, r.getPathForObject(name), size)
 	} else {
-		fmt.Println(name)
+		r.logf("%s\n", name)
+	}
+}
+
+// logf writes a message about the progress of the download, which goes to stderr when objects, an archive or the output
+// of --exec-pipe commands are written to stdout
+func (r *runner) logf(format string, a ...interface{}) {
+	log := r.log
+	if log == nil {
+		log = os.Stdout
 	}
+	_, _ = fmt.Fprintf(log, format, a...)
 }
@@ -17,11 +17,14 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/brianpursley/gsdownload/cmd/file"
 	"github.com/brianpursley/gsdownload/cmd/storage"
 	"io"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -94,16 +97,19 @@ func TestCommandShouldRunSuccessfully(t *testing.T) {
 
 	testCases := map[string]struct {
 		dryRun        bool
+		listShards    int
 		maxConcurrent int
 		maxObjects    int
 		expectError   bool
 	}{
-		"1 max concurrent, 3 max objects":         {maxConcurrent: 1, maxObjects: 3},
-		"1 max concurrent, 2 max objects":         {maxConcurrent: 1, maxObjects: 2, expectError: true},
-		"8 max concurrent, 3 max objects":         {maxConcurrent: 8, maxObjects: 3},
-		"8 max concurrent, 2 max objects":         {maxConcurrent: 8, maxObjects: 2, expectError: true},
-		"dryRun, 8 max concurrent, 3 max objects": {dryRun: true, maxConcurrent: 8, maxObjects: 3},
-		"dryRun, 8 max concurrent, 2 max objects": {dryRun: true, maxConcurrent: 8, maxObjects: 2, expectError: true},
+		"1 max concurrent, 3 max objects":                {maxConcurrent: 1, maxObjects: 3},
+		"1 max concurrent, 2 max objects":                {maxConcurrent: 1, maxObjects: 2, expectError: true},
+		"8 max concurrent, 3 max objects":                {maxConcurrent: 8, maxObjects: 3},
+		"8 max concurrent, 2 max objects":                {maxConcurrent: 8, maxObjects: 2, expectError: true},
+		"dryRun, 8 max concurrent, 3 max objects":        {dryRun: true, maxConcurrent: 8, maxObjects: 3},
+		"dryRun, 8 max concurrent, 2 max objects":        {dryRun: true, maxConcurrent: 8, maxObjects: 2, expectError: true},
+		"4 list shards, 8 max concurrent, 3 max objects": {listShards: 4, maxConcurrent: 8, maxObjects: 3},
+		"4 list shards, 8 max concurrent, 2 max objects": {listShards: 4, maxConcurrent: 8, maxObjects: 2, expectError: true},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(tt *testing.T) {
@@ -150,6 +156,7 @@ func TestCommandShouldRunSuccessfully(t *testing.T) {
 			_ = command.Flag("max-concurrent").Value.Set(strconv.Itoa(tc.maxConcurrent))
 			_ = command.Flag("dry-run").Value.Set(strconv.FormatBool(tc.dryRun))
 			_ = command.Flag("max-objects").Value.Set(strconv.Itoa(tc.maxObjects))
+			_ = command.Flag("list-shards").Value.Set(strconv.Itoa(tc.listShards))
 			err := command.Execute()
 			if tc.expectError {
 				if err == nil {
@@ -227,3 +234,279 @@ func TestCommandShouldHandleNoResults(t *testing.T) {
 		})
 	}
 }
+
+func TestCommandShouldHonorStartAfterAndEndBefore(t *testing.T) {
+	testCases := map[string]struct {
+		startAfter    string
+		endBefore     string
+		expectedPaths []string
+		expectError   bool
+	}{
+		"no offsets":             {expectedPaths: []string{"path/2026-09-30", "path/2026-10-01", "path/2026-10-15", "path/2026-10-16"}},
+		"start after":            {startAfter: "logs/2026-10-01", expectedPaths: []string{"path/2026-10-15", "path/2026-10-16"}},
+		"end before":             {endBefore: "logs/2026-10-15", expectedPaths: []string{"path/2026-09-30", "path/2026-10-01"}},
+		"start after and before": {startAfter: "logs/2026-10", endBefore: "logs/2026-10-16", expectedPaths: []string{"path/2026-10-01", "path/2026-10-15"}},
+		"start after end before": {startAfter: "logs/2026-10-16", endBefore: "logs/2026-10-01", expectError: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					return []storage.ObjectInfo{
+						{Name: "logs/2026-09-30"},
+						{Name: "logs/2026-10-01"},
+						{Name: "logs/2026-10-15"},
+						{Name: "logs/2026-10-16"},
+					}
+				},
+				ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+					return []byte(objectName)
+				},
+			}
+
+			mutex := sync.Mutex{}
+			copied := map[string]bool{}
+			fileCopier = &file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					copied[path] = true
+					return 0, nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "logs", "path"})
+			_ = command.Flag("start-after").Value.Set(tc.startAfter)
+			_ = command.Flag("end-before").Value.Set(tc.endBefore)
+			err := command.Execute()
+			if tc.expectError {
+				if err == nil {
+					tt.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+
+			if len(copied) != len(tc.expectedPaths) {
+				tt.Fatalf("wrong file count: expected %d, got %d", len(tc.expectedPaths), len(copied))
+			}
+			for _, path := range tc.expectedPaths {
+				if !copied[path] {
+					tt.Fatalf("missing file %q", path)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandShouldHonorMaxDepth(t *testing.T) {
+	testCases := map[string]struct {
+		noRecursive   bool
+		maxDepth      int
+		expectedPaths []string
+		expectError   bool
+	}{
+		"unlimited":                  {expectedPaths: []string{"path/a", "path/b/c", "path/b/d/e"}},
+		"no recursive":               {noRecursive: true, expectedPaths: []string{"path/a"}},
+		"max depth 2":                {maxDepth: 2, expectedPaths: []string{"path/a", "path/b/c"}},
+		"no recursive and max depth": {noRecursive: true, maxDepth: 2, expectError: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					return []storage.ObjectInfo{
+						{Name: "prefix/a"},
+						{Name: "prefix/b/c"},
+						{Name: "prefix/b/d/e"},
+					}
+				},
+				ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+					return []byte(objectName)
+				},
+			}
+
+			mutex := sync.Mutex{}
+			copied := map[string]bool{}
+			fileCopier = &file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					copied[path] = true
+					return 0, nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path"})
+			_ = command.Flag("no-recursive").Value.Set(strconv.FormatBool(tc.noRecursive))
+			_ = command.Flag("max-depth").Value.Set(strconv.Itoa(tc.maxDepth))
+			err := command.Execute()
+			if tc.expectError {
+				if err == nil {
+					tt.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+
+			if len(copied) != len(tc.expectedPaths) {
+				tt.Fatalf("wrong file count: expected %d, got %d", len(tc.expectedPaths), len(copied))
+			}
+			for _, path := range tc.expectedPaths {
+				if !copied[path] {
+					tt.Fatalf("missing file %q", path)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandShardsShouldBeDisjointAndComplete(t *testing.T) {
+	var objects []storage.ObjectInfo
+	for i := 0; i < 100; i++ {
+		objects = append(objects, storage.ObjectInfo{Name: fmt.Sprintf("prefix/object-%d", i)})
+	}
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return objects
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	mutex := sync.Mutex{}
+	copied := map[string]int{}
+	fileCopier = &file.MockCopier{
+		CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			copied[path]++
+			return 0, nil
+		},
+	}
+
+	shardCount := 3
+	for shardIndex := 0; shardIndex < shardCount; shardIndex++ {
+		command := NewCommand()
+		command.SetArgs([]string{"bucket", "prefix", "path"})
+		_ = command.Flag("shard-index").Value.Set(strconv.Itoa(shardIndex))
+		_ = command.Flag("shard-count").Value.Set(strconv.Itoa(shardCount))
+		if err := command.Execute(); err != nil {
+			t.Fatalf("execute failed: %v", err)
+		}
+	}
+
+	if len(copied) != len(objects) {
+		t.Fatalf("wrong file count: expected %d, got %d", len(objects), len(copied))
+	}
+	for path, count := range copied {
+		if count != 1 {
+			t.Fatalf("file %q copied %d times", path, count)
+		}
+	}
+}
+
+func TestConfigureShardValidation(t *testing.T) {
+	testCases := map[string]struct {
+		shardIndex  int
+		shardCount  int
+		expectError bool
+	}{
+		"no sharding":          {},
+		"first shard":          {shardIndex: 0, shardCount: 2},
+		"last shard":           {shardIndex: 1, shardCount: 2},
+		"index equal to count": {shardIndex: 2, shardCount: 2, expectError: true},
+		"negative index":       {shardIndex: -1, shardCount: 2, expectError: true},
+		"negative count":       {shardCount: -1, expectError: true},
+		"index without count":  {shardIndex: 1, expectError: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			runner := runner{shardIndex: tc.shardIndex, shardCount: tc.shardCount}
+			err := runner.configure(NewCommand(), []string{"bucket", "prefix", "path"})
+			if tc.expectError && err == nil {
+				tt.Fatalf("expected error")
+			}
+			if !tc.expectError && err != nil {
+				tt.Fatalf("configure failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestCommandWithToStdoutShouldWriteObjectsInNameOrder(t *testing.T) {
+	var objects []storage.ObjectInfo
+	for i := 9; i >= 0; i-- {
+		objects = append(objects, storage.ObjectInfo{Name: fmt.Sprintf("prefix/%02d", i), Size: int64(100 - i)})
+	}
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return objects
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName + "\n")
+		},
+	}
+
+	output := &bytes.Buffer{}
+	originalStdout := stdout
+	defer func() { stdout = originalStdout }()
+	stdout = output
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "--to-stdout", "--max-concurrent", "8", "--large-object-threshold", "95"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+
+	var expected strings.Builder
+	for i := 0; i < 10; i++ {
+		expected.WriteString(fmt.Sprintf("prefix/%02d\n", i))
+	}
+	if output.String() != expected.String() {
+		t.Fatalf("wrong output: expected %q, got %q", expected.String(), output.String())
+	}
+}
+
+func TestConfigureStreamValidation(t *testing.T) {
+	testCases := map[string]struct {
+		runner        *runner
+		args          []string
+		expectedError string
+	}{
+		"to stdout":                   {runner: &runner{toStdout: true}, args: []string{"bucket", "prefix"}},
+		"exec pipe":                   {runner: &runner{execPipe: "cat"}, args: []string{"bucket", "prefix"}},
+		"to stdout with output":       {runner: &runner{toStdout: true}, args: []string{"bucket", "prefix", "path"}, expectedError: "accepts 2 arg(s)"},
+		"output required":             {runner: &runner{}, args: []string{"bucket", "prefix"}, expectedError: "requires at least 3 arg(s)"},
+		"to stdout and exec pipe":     {runner: &runner{toStdout: true, execPipe: "cat"}, args: []string{"bucket", "prefix"}, expectedError: "--to-stdout cannot be used with --exec-pipe"},
+		"to stdout with archive":      {runner: &runner{toStdout: true, archive: "tar"}, args: []string{"bucket", "prefix"}, expectedError: "cannot be used with --archive"},
+		"to stdout with retries":      {runner: &runner{toStdout: true, retries: 1}, args: []string{"bucket", "prefix"}, expectedError: "cannot be used with --retries"},
+		"to stdout with size order":   {runner: &runner{toStdout: true, order: orderSizeAscending}, args: []string{"bucket", "prefix"}, expectedError: "cannot be used with --order"},
+		"exec pipe with claim prefix": {runner: &runner{execPipe: "cat", claimPrefix: "claims", leaseDuration: 1}, args: []string{"bucket", "prefix"}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			err := tc.runner.configure(NewCommand(), tc.args)
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("configure failed: %v", err)
+			}
+			// The objects or the output of the commands go to stdout, so the log must not
+			if tc.runner.log != os.Stderr {
+				tt.Fatalf("expected log to be written to stderr")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/checksum"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	decompressNone = "none"
+	decompressAuto = "auto"
+	decompressGzip = "gzip"
+	decompressZstd = "zstd"
+)
+
+// compressionExtensions maps each compression to the extension of object names compressed with it
+var compressionExtensions = map[string]string{
+	decompressGzip: ".gz",
+	decompressZstd: ".zst",
+}
+
+// getCompressionForObject returns the compression of an object that is decompressed by --decompress, based on its
+// content encoding or the extension of its name, or an empty string if it is downloaded as is
+func (r *runner) getCompressionForObject(obj *storage.ObjectInfo) string {
+	encoding := strings.ToLower(obj.ContentEncoding)
+	if _, ok := compressionExtensions[encoding]; ok && r.isDecompressed(encoding) {
+		return encoding
+	}
+	return r.getCompressionForName(obj.Name)
+}
+
+// getCompressionForName returns the compression of an object that is decompressed by --decompress, based on the
+// extension of its name, or an empty string if the name has no such extension
+func (r *runner) getCompressionForName(name string) string {
+	for _, compression := range []string{decompressGzip, decompressZstd} {
+		if r.isDecompressed(compression) && strings.HasSuffix(name, compressionExtensions[compression]) {
+			return compression
+		}
+	}
+	return ""
+}
+
+func (r *runner) isDecompressed(compression string) bool {
+	return r.decompress == decompressAuto || r.decompress == compression
+}
+
+// downloadObjectDecompressed downloads an object's content as it is stored, decompressing it on the fly and verifying
+// the checksum of the stored content once it has all been read
+func (r *runner) downloadObjectDecompressed(ctx context.Context, obj *storage.ObjectInfo, compression string) error {
+	start := time.Now()
+	reader, err := r.readObjectCompressed(ctx, obj.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create new reader for %s: %w", obj.Name, err)
+	}
+	defer reader.Close()
+
+	decompressed, err := newDecompressingReader(reader, compression, obj)
+	if err != nil {
+		return fmt.Errorf("failed to decompress %s: %v", obj.Name, err)
+	}
+	defer decompressed.Close()
+
+	bytes, err := r.copyObject(ctx, obj, decompressed)
+	if err != nil {
+		return fmt.Errorf("failed writing to file %s: %v", obj.Name, err)
+	}
+	r.throughput.record(obj.Size, time.Since(start))
+
+	r.printObject(obj.Name, bytes)
+	return nil
+}
+
+// readObjectCompressed opens a reader for an object's content as it is stored
+func (r *runner) readObjectCompressed(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := storageClient.ReadObjectCompressed(r.observeThrottling(ctx), r.bucketName, objectName)
+	return r.wrapReader(ctx, reader, time.Since(start), err)
+}
+
+// decompressingReader decompresses data, while computing the checksum of the compressed data
+type decompressingReader struct {
+	obj          *storage.ObjectInfo
+	compressed   io.Reader
+	hash         hash.Hash32
+	decompressor io.ReadCloser
+}
+
+func newDecompressingReader(reader io.Reader, compression string, obj *storage.ObjectInfo) (*decompressingReader, error) {
+	d := &decompressingReader{obj: obj, hash: checksum.NewCRC32C()}
+	d.compressed = io.TeeReader(reader, d.hash)
+
+	var err error
+	switch compression {
+	case decompressGzip:
+		d.decompressor, err = gzip.NewReader(d.compressed)
+	case decompressZstd:
+		var decoder *zstd.Decoder
+		// Decode synchronously, so that all compressed data has been hashed by the time decompression finishes
+		decoder, err = zstd.NewReader(d.compressed, zstd.WithDecoderConcurrency(1))
+		if err == nil {
+			d.decompressor = decoder.IOReadCloser()
+		}
+	default:
+		err = fmt.Errorf("unsupported compression %q", compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *decompressingReader) Read(p []byte) (int, error) {
+	n, err := d.decompressor.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+
+	// Include anything after the compressed stream in the checksum
+	if _, err := io.Copy(io.Discard, d.compressed); err != nil {
+		return n, err
+	}
+	if crc32c := d.hash.Sum32(); crc32c != d.obj.CRC32C {
+		return n, fmt.Errorf("checksum mismatch for %s: expected crc32c %08x, got %08x", d.obj.Name, d.obj.CRC32C, crc32c)
+	}
+	return n, io.EOF
+}
+
+func (d *decompressingReader) Close() error {
+	return d.decompressor.Close()
+}
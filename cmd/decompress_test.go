@@ -0,0 +1,181 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/checksum"
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compressForTest(t *testing.T, compression string, content []byte) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch compression {
+	case decompressGzip:
+		writer = gzip.NewWriter(&buf)
+	case decompressZstd:
+		encoder, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer = encoder
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func crc32cForTest(content []byte) uint32 {
+	hash := checksum.NewCRC32C()
+	hash.Write(content)
+	return hash.Sum32()
+}
+
+func TestCommandShouldDecompressObjects(t *testing.T) {
+	gzipped := compressForTest(t, decompressGzip, []byte("gzip content"))
+	zstded := compressForTest(t, decompressZstd, []byte("zstd content"))
+	transcoded := compressForTest(t, decompressGzip, []byte("transcoded content"))
+	stored := map[string][]byte{
+		"prefix/a.txt.gz":  gzipped,
+		"prefix/b.txt.zst": zstded,
+		"prefix/c.txt":     transcoded,
+		"prefix/d.txt":     []byte("plain content"),
+	}
+
+	testCases := map[string]struct {
+		decompress    string
+		expectedFiles map[string]string
+	}{
+		"auto": {
+			decompress: decompressAuto,
+			expectedFiles: map[string]string{
+				"path/a.txt": "gzip content",
+				"path/b.txt": "zstd content",
+				"path/c.txt": "transcoded content",
+				"path/d.txt": "plain content",
+			},
+		},
+		"gzip": {
+			decompress: decompressGzip,
+			expectedFiles: map[string]string{
+				"path/a.txt":     "gzip content",
+				"path/b.txt.zst": string(zstded),
+				"path/c.txt":     "transcoded content",
+				"path/d.txt":     "plain content",
+			},
+		},
+		"none": {
+			decompress: decompressNone,
+			expectedFiles: map[string]string{
+				"path/a.txt.gz":  string(gzipped),
+				"path/b.txt.zst": string(zstded),
+				"path/c.txt":     string(transcoded),
+				"path/d.txt":     "plain content",
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					objects := []storage.ObjectInfo{
+						{Name: "prefix/a.txt.gz"},
+						{Name: "prefix/b.txt.zst"},
+						{Name: "prefix/c.txt", ContentEncoding: "gzip"},
+						{Name: "prefix/d.txt"},
+					}
+					for i := range objects {
+						objects[i].Size = int64(len(stored[objects[i].Name]))
+						objects[i].CRC32C = crc32cForTest(stored[objects[i].Name])
+					}
+					return objects
+				},
+				ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+					return stored[objectName]
+				},
+			}
+			var mutex sync.Mutex
+			files := map[string]string{}
+			fileCopier = &file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					content, err := io.ReadAll(reader)
+					mutex.Lock()
+					defer mutex.Unlock()
+					files[path] = string(content)
+					return int64(len(content)), err
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path", "--decompress", tc.decompress})
+			if err := command.Execute(); err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			if len(files) != len(tc.expectedFiles) {
+				tt.Fatalf("expected %d files, got %v", len(tc.expectedFiles), files)
+			}
+			for path, expected := range tc.expectedFiles {
+				if files[path] != expected {
+					tt.Errorf("wrong content for %s: expected %q, got %q", path, expected, files[path])
+				}
+			}
+		})
+	}
+}
+
+func TestCommandShouldFailDecompressWithChecksumMismatch(t *testing.T) {
+	gzipped := compressForTest(t, decompressGzip, []byte("gzip content"))
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{{Name: "prefix/a.txt.gz", Size: int64(len(gzipped)), CRC32C: crc32cForTest(gzipped) + 1}}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return gzipped
+		},
+	}
+	fileCopier = &file.MockCopier{
+		CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+			return io.Copy(io.Discard, reader)
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "path", "--decompress", decompressAuto})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestConfigureDecompressValidation(t *testing.T) {
+	r := &runner{decompress: "bogus"}
+	if err := r.configure(NewCommand(), []string{"bucket", "prefix", "path"}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// freeSpaceCheckInterval is how often free space is checked while downloading
+var freeSpaceCheckInterval = 5 * time.Second
+
+// checkFreeSpace returns an error if there is not enough free space in each filesystem to download the objects saved
+// in the output directories on it and still leave --min-free-space available. Existing files count towards the
+// available space, since they will be replaced. The size of an object that is decompressed is not known until it has
+// been downloaded, so only its compressed size is counted.
+func (r *runner) checkFreeSpace(reporter file.SpaceReporter, objects []*storage.ObjectInfo) error {
+	required := map[string]int64{}
+	decompressed := 0
+	for _, obj := range objects {
+		existing, err := reporter.FileSize(r.getPathForObject(obj.Name))
+		if err != nil {
+			return fmt.Errorf("failed to get size of existing file for %s: %v", obj.Name, err)
+		}
+		if obj.Size > existing {
+			required[r.getDirectoryForObject(obj.Name)] += obj.Size - existing
+		}
+		if r.getCompressionForObject(obj) != "" {
+			decompressed++
+		}
+	}
+	if decompressed > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: %d objects will be decompressed, so the free space check only counts their compressed size\n", decompressed)
+	}
+
+	// Output directories on the same filesystem share its free space
+	type filesystemSpace struct {
+		dirs     []string
+		required int64
+		free     int64
+	}
+	var filesystems []*filesystemSpace
+	byID := map[string]*filesystemSpace{}
+	for _, dir := range r.outputDirectories {
+		free, err := reporter.FreeSpace(dir)
+		if errors.Is(err, file.ErrFreeSpaceNotSupported) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get free space for %s: %v", dir, err)
+		}
+		id, err := reporter.Filesystem(dir)
+		if err != nil {
+			return fmt.Errorf("failed to get filesystem for %s: %v", dir, err)
+		}
+		fs, ok := byID[id]
+		if !ok {
+			fs = &filesystemSpace{free: free}
+			byID[id] = fs
+			filesystems = append(filesystems, fs)
+		}
+		fs.dirs = append(fs.dirs, dir)
+		fs.required += required[dir]
+	}
+
+	for _, fs := range filesystems {
+		if fs.required+int64(r.minFreeSpace) > fs.free {
+			return fmt.Errorf("not enough free space in %s: %s required (plus %s --min-free-space), %s available",
+				strings.Join(fs.dirs, ", "), formatByteSize(fs.required), formatByteSize(int64(r.minFreeSpace)), formatByteSize(fs.free))
+		}
+	}
+	return nil
+}
+
+// spaceWatchdog periodically checks free space and pauses downloads while it is below a minimum in any of the paths
+type spaceWatchdog struct {
+	reporter file.SpaceReporter
+	paths    []string
+	minFree  int64
+
+	mutex  sync.Mutex
+	resume chan struct{}
+}
+
+// check updates whether downloads are paused based on the current free space
+func (w *spaceWatchdog) check() {
+	var free int64 = -1
+	for _, path := range w.paths {
+		pathFree, err := w.reporter.FreeSpace(path)
+		if err != nil {
+			// Don't pause downloads because of a transient failure, since the filesystem itself will report running out
+			return
+		}
+		if free < 0 || pathFree < free {
+			free = pathFree
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if free < w.minFree && w.resume == nil {
+		fmt.Fprintf(os.Stderr, "pausing downloads, free space %s is below --min-free-space %s\n", formatByteSize(free), formatByteSize(w.minFree))
+		w.resume = make(chan struct{})
+	} else if free >= w.minFree && w.resume != nil {
+		fmt.Fprintf(os.Stderr, "resuming downloads, free space is %s\n", formatByteSize(free))
+		close(w.resume)
+		w.resume = nil
+	}
+}
+
+// run checks free space each interval until the context is done
+func (w *spaceWatchdog) run(ctx context.Context) {
+	ticker := time.NewTicker(freeSpaceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// wait blocks while downloads are paused
+func (w *spaceWatchdog) wait(ctx context.Context) error {
+	w.mutex.Lock()
+	resume := w.resume
+	w.mutex.Unlock()
+	if resume == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resume:
+		return nil
+	}
+}
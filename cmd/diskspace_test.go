@@ -0,0 +1,181 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestCommandShouldFailWithoutEnoughFreeSpace(t *testing.T) {
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{{Name: "prefix/foo", Size: 600}, {Name: "prefix/bar", Size: 600}}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	testCases := map[string]struct {
+		existing      int64
+		minFreeSpace  string
+		expectedError string
+	}{
+		"enough space":               {existing: 200},
+		"not enough space":           {expectedError: "not enough free space in path: 1200 required (plus 0 --min-free-space), 1000 available"},
+		"not enough with min free":   {existing: 200, minFreeSpace: "300", expectedError: "not enough free space in path: 800 required (plus 300 --min-free-space), 1000 available"},
+		"existing files are counted": {existing: 600},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			copied := 0
+			fileCopier = &file.MockSpaceCopier{
+				MockCopier: file.MockCopier{
+					CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+						copied++
+						return 0, nil
+					},
+				},
+				FreeSpaceImplementation: func(path string) (int64, error) {
+					return 1000, nil
+				},
+				FileSizeImplementation: func(path string) (int64, error) {
+					return tc.existing, nil
+				},
+			}
+
+			args := []string{"bucket", "prefix", "path", "--max-concurrent", "1"}
+			if tc.minFreeSpace != "" {
+				args = append(args, "--min-free-space", tc.minFreeSpace)
+			}
+			command := NewCommand()
+			command.SetArgs(args)
+			err := command.Execute()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				if copied != 0 {
+					tt.Fatalf("expected no objects to be copied, got %d", copied)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestCommandShouldCheckFreeSpaceOfDirectoriesOnSameFilesystemTogether(t *testing.T) {
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{{Name: "prefix/foo", Size: 600}, {Name: "prefix/bar", Size: 600}}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	testCases := map[string]struct {
+		filesystems   map[string]string
+		expectedError string
+	}{
+		"separate filesystems": {filesystems: map[string]string{"disk1": "a", "disk2": "b"}},
+		"same filesystem": {
+			filesystems:   map[string]string{"disk1": "a", "disk2": "a"},
+			expectedError: "not enough free space in disk1, disk2: 1200 required (plus 0 --min-free-space), 1000 available",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			fileCopier = &file.MockSpaceCopier{
+				MockCopier: file.MockCopier{
+					CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+						return 0, nil
+					},
+				},
+				FreeSpaceImplementation: func(path string) (int64, error) {
+					return 1000, nil
+				},
+				FileSizeImplementation: func(path string) (int64, error) {
+					return 0, nil
+				},
+				FilesystemImplementation: func(path string) (string, error) {
+					return tc.filesystems[path], nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "disk1", "disk2", "--max-concurrent", "1"})
+			err := command.Execute()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestSpaceWatchdogShouldPauseAndResume(t *testing.T) {
+	var free int64 = 50
+	w := &spaceWatchdog{
+		reporter: &file.MockSpaceCopier{
+			FreeSpaceImplementation: func(path string) (int64, error) {
+				return atomic.LoadInt64(&free), nil
+			},
+		},
+		paths:   []string{"path"},
+		minFree: 100,
+	}
+
+	w.check()
+	done := make(chan error)
+	go func() {
+		done <- w.wait(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("wait should block while free space is low")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	atomic.StoreInt64(&free, 200)
+	w.check()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("wait failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("wait should return once free space is available")
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// extractDirectory returns the directory that an archive is extracted to, or an empty string if the path is not an archive
+func extractDirectory(path string) string {
+	ext := file.ArchiveExtension(path)
+	if ext == "" {
+		return ""
+	}
+	return strings.TrimSuffix(path, ext)
+}
+
+// checkExtractDirectories returns an error if an archive would be extracted to the same directory as another archive,
+// or to a directory that another object is saved in, since extracting it would replace that object
+func (r *runner) checkExtractDirectories(objects []*storage.ObjectInfo) error {
+	archives := map[string]string{}
+	for _, obj := range objects {
+		dirPath := extractDirectory(filepath.Clean(r.getPathForObject(obj.Name)))
+		if dirPath == "" {
+			continue
+		}
+		if other, ok := archives[dirPath]; ok {
+			return fmt.Errorf("cannot extract both %s and %s to %s", other, obj.Name, dirPath)
+		}
+		archives[dirPath] = obj.Name
+	}
+
+	for _, obj := range objects {
+		path := filepath.Clean(r.getPathForObject(obj.Name))
+		for dir := path; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if archive, ok := archives[dir]; ok {
+				return fmt.Errorf("cannot extract %s to %s, because %s is saved there", archive, dir, obj.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// extractObject unpacks a downloaded object into a directory named after it, if it is an archive
+func (r *runner) extractObject(obj *storage.ObjectInfo) error {
+	extractor, ok := r.copier.(file.Extractor)
+	if !ok {
+		return nil
+	}
+	path := r.getPathForObject(obj.Name)
+	dirPath := extractDirectory(path)
+	if dirPath == "" {
+		return nil
+	}
+
+	limits := file.ExtractLimits{
+		MaxBytes: int64(r.extractMaxBytes),
+		MaxFiles: r.extractMaxFiles,
+		MaxRatio: r.extractMaxRatio,
+	}
+	if err := extractor.Extract(path, dirPath, limits); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", obj.Name, err)
+	}
+	if r.verbose {
+		r.logf("Extracted %s to %s\n", obj.Name, dirPath)
+	}
+
+	if r.extractDelete {
+		if err := extractor.Remove(path); err != nil {
+			return fmt.Errorf("failed to delete %s after extracting it: %v", path, err)
+		}
+	}
+	return nil
+}
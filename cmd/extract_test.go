@@ -0,0 +1,144 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestCommandShouldExtractArchives(t *testing.T) {
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{
+				{Name: "prefix/a.tar.gz"},
+				{Name: "prefix/b.zip"},
+				{Name: "prefix/c.txt"},
+			}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	for _, extractDelete := range []bool{false, true} {
+		var mutex sync.Mutex
+		var extracted, removed []string
+		fileCopier = &file.MockExtractCopier{
+			MockCopier: file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					return io.Copy(io.Discard, reader)
+				},
+			},
+			ExtractImplementation: func(archivePath, dirPath string, limits file.ExtractLimits) error {
+				if limits.MaxFiles != 10 {
+					t.Errorf("wrong limits: %+v", limits)
+				}
+				mutex.Lock()
+				defer mutex.Unlock()
+				extracted = append(extracted, archivePath+"->"+dirPath)
+				return nil
+			},
+			RemoveImplementation: func(path string) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				removed = append(removed, path)
+				return nil
+			},
+		}
+
+		args := []string{"bucket", "prefix", "path", "--extract", "--extract-max-files", "10"}
+		if extractDelete {
+			args = append(args, "--extract-delete")
+		}
+		command := NewCommand()
+		command.SetArgs(args)
+		if err := command.Execute(); err != nil {
+			t.Fatalf("execute failed: %v", err)
+		}
+
+		sort.Strings(extracted)
+		expected := "path/a.tar.gz->path/a,path/b.zip->path/b"
+		if strings.Join(extracted, ",") != expected {
+			t.Fatalf("wrong extractions: expected %q, got %q", expected, strings.Join(extracted, ","))
+		}
+		if extractDelete != (len(removed) == 2) {
+			t.Fatalf("wrong removed files with --extract-delete=%v: %v", extractDelete, removed)
+		}
+	}
+}
+
+func TestConfigureExtractValidation(t *testing.T) {
+	testCases := map[string]*runner{
+		"delete without extract": {extractDelete: true},
+		"with archive":           {extract: true, archive: "tar"},
+		"negative limit":         {extract: true, extractMaxFiles: -1},
+	}
+	for name, r := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			if err := r.configure(NewCommand(), []string{"bucket", "prefix", "path"}); err == nil {
+				tt.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestCommandShouldRefuseToExtractOverOtherObjects(t *testing.T) {
+	testCases := map[string][]storage.ObjectInfo{
+		"object in directory": {{Name: "prefix/foo.tar.gz"}, {Name: "prefix/foo/bar.txt"}},
+		"object at directory": {{Name: "prefix/foo.zip"}, {Name: "prefix/foo"}},
+		"same directory":      {{Name: "prefix/foo.tar.gz"}, {Name: "prefix/foo.zip"}},
+	}
+	for name, objects := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					return objects
+				},
+			}
+			copied := false
+			fileCopier = &file.MockExtractCopier{
+				MockCopier: file.MockCopier{
+					CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+						copied = true
+						return io.Copy(io.Discard, reader)
+					},
+				},
+				ExtractImplementation: func(archivePath, dirPath string, limits file.ExtractLimits) error {
+					tt.Errorf("unexpected extraction of %s", archivePath)
+					return nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path", "--extract"})
+			err := command.Execute()
+			if err == nil || !strings.Contains(err.Error(), "cannot extract") {
+				tt.Fatalf("expected error, got %v", err)
+			}
+			if copied {
+				tt.Fatalf("expected nothing to be downloaded")
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/brianpursley/gsdownload/cmd/shell"
+)
+
+// ExecCopier provides the ability to copy data to the stdin of a command, which is run once for each file.
+// The command's stdout and stderr are passed through, and the file is described to the command by the
+// GSDOWNLOAD_OBJECT, GSDOWNLOAD_PATH and GSDOWNLOAD_CONTENT_TYPE environment variables.
+type ExecCopier struct {
+	commandLine string
+	root        string
+}
+
+// NewExecCopier creates a new ExecCopier instance. GSDOWNLOAD_PATH is the path of each file relative to root.
+func NewExecCopier(commandLine string, root string) *ExecCopier {
+	return &ExecCopier{commandLine: commandLine, root: root}
+}
+
+// CopyToFile copies data from a reader to the stdin of a new command
+func (c *ExecCopier) CopyToFile(path string, reader io.Reader) (int64, error) {
+	return c.CopyToFileWithAttributes(path, reader, Attributes{})
+}
+
+// CopyToFileWithAttributes copies data from a reader to the stdin of a new command, describing the file to the
+// command using environment variables
+func (c *ExecCopier) CopyToFileWithAttributes(path string, reader io.Reader, attributes Attributes) (int64, error) {
+	return c.CopyToFileWithContext(context.Background(), path, reader, attributes)
+}
+
+// CopyToFileWithContext copies data from a reader to the stdin of a new command, describing the file to the command
+// using environment variables. The command is killed if the context is done before it exits.
+func (c *ExecCopier) CopyToFileWithContext(ctx context.Context, path string, reader io.Reader, attributes Attributes) (int64, error) {
+	name, err := entryName(c.root, path)
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := shell.Command(ctx, c.commandLine,
+		"GSDOWNLOAD_OBJECT="+attributes.Name,
+		"GSDOWNLOAD_PATH="+name,
+		"GSDOWNLOAD_CONTENT_TYPE="+attributes.ContentType,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start command for %s: %v", name, err)
+	}
+
+	bytes, copyErr := io.Copy(stdin, reader)
+	_ = stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return bytes, fmt.Errorf("command failed for %s: %v", name, err)
+	}
+	// A command that succeeds without reading all of its input, such as head, is not an error
+	if copyErr != nil && !errors.Is(copyErr, syscall.EPIPE) {
+		return bytes, fmt.Errorf("failed writing to command for %s: %v", name, copyErr)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecCopierRunsCommandForEachFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands use a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	copier := NewExecCopier(`cat > "$OUTPUT_DIR/$(basename "$GSDOWNLOAD_PATH")" && echo "$GSDOWNLOAD_OBJECT" >> "$OUTPUT_DIR/names"`, "root")
+	t.Setenv("OUTPUT_DIR", dir)
+
+	n, err := copier.CopyToFileWithAttributes("root/dir/foo", strings.NewReader("foo content"), Attributes{Name: "prefix/dir/foo"})
+	if err != nil || n != int64(len("foo content")) {
+		t.Fatalf("copy failed: %d, %v", n, err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "foo"))
+	if err != nil || string(content) != "foo content" {
+		t.Fatalf("wrong content: %q, %v", content, err)
+	}
+	names, err := os.ReadFile(filepath.Join(dir, "names"))
+	if err != nil || string(names) != "prefix/dir/foo\n" {
+		t.Fatalf("wrong object name: %q, %v", names, err)
+	}
+
+	if _, err := NewExecCopier("exit 3", "root").CopyToFile("root/foo", strings.NewReader("foo")); err == nil || !strings.Contains(err.Error(), "command failed for foo") {
+		t.Fatalf("expected command failure, got %v", err)
+	}
+
+	// A command that stops reading early but succeeds is not an error
+	large := strings.NewReader(strings.Repeat("x", 1<<20))
+	if _, err := NewExecCopier("head -c 1 > /dev/null", "root").CopyToFile("root/foo", large); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+}
+
+func TestExecCopierKillsCommandWhenContextIsDone(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands use a POSIX shell")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewExecCopier("exec sleep 10", "root").CopyToFileWithContext(ctx, "root/foo", strings.NewReader("foo"), Attributes{})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected command to be killed, but it took %v", elapsed)
+	}
+}
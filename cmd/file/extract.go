@@ -0,0 +1,249 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrExtractLimitExceeded is returned when an archive contains more than is allowed by the ExtractLimits
+var ErrExtractLimitExceeded = errors.New("archive exceeds extraction limits")
+
+// archiveExtensions are the extensions of archives that can be extracted, with longer extensions first so that
+// .tar.gz is matched before .gz would be
+var archiveExtensions = []string{".tar.gz", ".tar.zst", ".tgz", ".tzst", ".tar", ".zip"}
+
+// ArchiveExtension returns the extension of a path if it is an archive that can be extracted, or an empty string
+func ArchiveExtension(path string) string {
+	lower := strings.ToLower(path)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) && len(path) > len(ext) {
+			return path[len(path)-len(ext):]
+		}
+	}
+	return ""
+}
+
+// ExtractMarkerName is the name of the file written into each directory that an archive is extracted to, so that the
+// directory can be recognized and replaced when the archive is extracted again
+const ExtractMarkerName = ".gsdownload-extracted"
+
+// Extract unpacks an archive into a directory. An existing directory is only replaced if an archive was extracted to it
+// before, so that nothing else is ever deleted. Entries are first extracted into a temporary directory next to it, so
+// the directory is left untouched if extraction fails. Entries that would be written outside the directory are
+// rejected, and links and special files are not extracted.
+func (c *OsCopier) Extract(archivePath, dirPath string, limits ExtractLimits) error {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dirPath); err == nil {
+		if _, err := os.Stat(filepath.Join(dirPath, ExtractMarkerName)); err != nil {
+			return fmt.Errorf("refusing to replace %s, which was not created by extracting an archive", dirPath)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if limits.MaxRatio > 0 {
+		maxBytes := int64(limits.MaxRatio * float64(info.Size()))
+		if limits.MaxBytes == 0 || maxBytes < limits.MaxBytes {
+			limits.MaxBytes = maxBytes
+		}
+	}
+
+	if err := c.safeMkdirAll(filepath.Dir(dirPath)); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(dirPath), err)
+	}
+	tempDir, err := os.MkdirTemp(filepath.Dir(dirPath), ".extract-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	e := &extraction{dir: tempDir, limits: limits}
+	ext := strings.ToLower(ArchiveExtension(archivePath))
+	if ext == ".zip" {
+		err = e.extractZip(archivePath)
+	} else {
+		err = e.extractTar(archivePath, ext)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, ExtractMarkerName), []byte(filepath.Base(archivePath)+"\n"), 0644); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dirPath); err != nil {
+		return err
+	}
+	return os.Rename(tempDir, dirPath)
+}
+
+// Remove deletes a file
+func (c *OsCopier) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// extraction writes the entries of an archive into a directory, keeping track of the limits
+type extraction struct {
+	dir    string
+	limits ExtractLimits
+	files  int
+	bytes  int64
+}
+
+func (e *extraction) extractTar(archivePath, ext string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	switch ext {
+	case ".tar.gz", ".tgz":
+		gzipReader, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case ".tar.zst", ".tzst":
+		decoder, err := zstd.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		reader = decoder
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.createDirectory(header.Name)
+		case tar.TypeReg:
+			err = e.createFile(header.Name, header.FileInfo().Mode(), tarReader)
+		default:
+			// Links could be used to write outside the directory, so they are not extracted, along with special files
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *extraction) extractZip(archivePath string) error {
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	for _, f := range zipReader.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = e.createDirectory(f.Name)
+		case mode.IsRegular():
+			err = e.createZipFile(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extraction) createZipFile(f *zip.File) error {
+	reader, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return e.createFile(f.Name, f.Mode(), reader)
+}
+
+func (e *extraction) createDirectory(name string) error {
+	path, err := e.pathForEntry(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+func (e *extraction) createFile(name string, mode os.FileMode, reader io.Reader) error {
+	path, err := e.pathForEntry(name)
+	if err != nil {
+		return err
+	}
+	e.files++
+	if e.limits.MaxFiles > 0 && e.files > e.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrExtractLimitExceeded, e.limits.MaxFiles)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if e.limits.MaxBytes > 0 {
+		// Read one byte more than is allowed, to tell whether the limit was exceeded
+		reader = io.LimitReader(reader, e.limits.MaxBytes-e.bytes+1)
+	}
+	n, err := io.Copy(f, reader)
+	e.bytes += n
+	if err != nil {
+		return err
+	}
+	if e.limits.MaxBytes > 0 && e.bytes > e.limits.MaxBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrExtractLimitExceeded, e.limits.MaxBytes)
+	}
+	return nil
+}
+
+// pathForEntry returns the path where an archive entry is extracted, or an error if it is outside the directory
+func (e *extraction) pathForEntry(name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" || strings.HasPrefix(name, "/") ||
+		cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q is outside of the extraction directory", name)
+	}
+	return filepath.Join(e.dir, cleaned), nil
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name     string
+	content  string
+	typeflag byte
+}
+
+func writeTestTarGz(t *testing.T, path string, entries []testEntry) {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Mode: 0644, Size: int64(len(entry.content))}
+		if entry.typeflag == tar.TypeSymlink {
+			header.Linkname = entry.content
+			header.Size = 0
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, path string, entries []testEntry) {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveExtension(t *testing.T) {
+	testCases := map[string]string{
+		"foo/bar.tar.gz":  ".tar.gz",
+		"foo/bar.TGZ":     ".TGZ",
+		"foo/bar.tar.zst": ".tar.zst",
+		"foo/bar.tar":     ".tar",
+		"foo/bar.zip":     ".zip",
+		"foo/bar.gz":      "",
+		"foo/bar.txt":     "",
+		".zip":            "",
+	}
+	for path, expected := range testCases {
+		if ext := ArchiveExtension(path); ext != expected {
+			t.Errorf("wrong extension for %q: expected %q, got %q", path, expected, ext)
+		}
+	}
+}
+
+func TestExtractUnpacksArchives(t *testing.T) {
+	entries := []testEntry{
+		{name: "dir/", typeflag: tar.TypeDir},
+		{name: "dir/a.txt", content: "a", typeflag: tar.TypeReg},
+		{name: "./b.txt", content: "bb", typeflag: tar.TypeReg},
+		{name: "link", content: "/etc/passwd", typeflag: tar.TypeSymlink},
+	}
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		t.Run(ext, func(tt *testing.T) {
+			dir := tt.TempDir()
+			archivePath := filepath.Join(dir, "archive"+ext)
+			if ext == ".zip" {
+				writeTestZip(tt, archivePath, entries[:3])
+			} else {
+				writeTestTarGz(tt, archivePath, entries)
+			}
+
+			dirPath := filepath.Join(dir, "archive")
+			if err := NewOsCopier().Extract(archivePath, dirPath, ExtractLimits{}); err != nil {
+				tt.Fatal(err)
+			}
+
+			// Extracting the archive again replaces anything else in the directory
+			if err := os.WriteFile(filepath.Join(dirPath, "stale.txt"), nil, 0644); err != nil {
+				tt.Fatal(err)
+			}
+			if err := NewOsCopier().Extract(archivePath, dirPath, ExtractLimits{}); err != nil {
+				tt.Fatal(err)
+			}
+
+			var files []string
+			err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				content, err := os.ReadFile(path)
+				rel, _ := filepath.Rel(dirPath, path)
+				files = append(files, filepath.ToSlash(rel)+"="+string(content))
+				return err
+			})
+			if err != nil {
+				tt.Fatal(err)
+			}
+			expected := ExtractMarkerName + "=archive" + ext + "\n,b.txt=bb,dir/a.txt=a"
+			if strings.Join(files, ",") != expected {
+				tt.Fatalf("wrong files: expected %q, got %q", expected, strings.Join(files, ","))
+			}
+		})
+	}
+}
+
+func TestExtractRefusesToReplaceOtherDirectories(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "archive.tar.gz")
+	writeTestTarGz(t, archivePath, []testEntry{{name: "a.txt", content: "a", typeflag: tar.TypeReg}})
+
+	// The directory was not created by extracting an archive, so it belongs to something else
+	dirPath := filepath.Join(dir, "archive")
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirPath, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := NewOsCopier().Extract(archivePath, dirPath, ExtractLimits{})
+	if err == nil || !strings.Contains(err.Error(), "refusing to replace") {
+		t.Fatalf("expected error, got %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dirPath, "b.txt")); err != nil || string(content) != "b" {
+		t.Fatalf("expected existing file to be left alone, got %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(dirPath, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected archive not to be extracted, got %v", err)
+	}
+
+	// The same applies to a file
+	if err := os.RemoveAll(dirPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dirPath, []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewOsCopier().Extract(archivePath, dirPath, ExtractLimits{}); err == nil {
+		t.Fatalf("expected error")
+	}
+	if content, err := os.ReadFile(dirPath); err != nil || string(content) != "c" {
+		t.Fatalf("expected existing file to be left alone, got %q, %v", content, err)
+	}
+}
+
+func TestExtractRejectsUnsafeArchives(t *testing.T) {
+	testCases := map[string]struct {
+		entries       []testEntry
+		limits        ExtractLimits
+		expectedError string
+		limitExceeded bool
+	}{
+		"parent directory": {
+			entries:       []testEntry{{name: "../escaped.txt", content: "x", typeflag: tar.TypeReg}},
+			expectedError: "outside of the extraction directory",
+		},
+		"nested parent directory": {
+			entries:       []testEntry{{name: "dir/../../escaped.txt", content: "x", typeflag: tar.TypeReg}},
+			expectedError: "outside of the extraction directory",
+		},
+		"absolute path": {
+			entries:       []testEntry{{name: "/tmp/escaped.txt", content: "x", typeflag: tar.TypeReg}},
+			expectedError: "outside of the extraction directory",
+		},
+		"too many bytes": {
+			entries:       []testEntry{{name: "a", content: "12345", typeflag: tar.TypeReg}, {name: "b", content: "12345", typeflag: tar.TypeReg}},
+			limits:        ExtractLimits{MaxBytes: 9},
+			limitExceeded: true,
+		},
+		"too many files": {
+			entries:       []testEntry{{name: "a", typeflag: tar.TypeReg}, {name: "b", typeflag: tar.TypeReg}},
+			limits:        ExtractLimits{MaxFiles: 1},
+			limitExceeded: true,
+		},
+		"ratio": {
+			entries:       []testEntry{{name: "a", content: strings.Repeat("0", 1<<20), typeflag: tar.TypeReg}},
+			limits:        ExtractLimits{MaxRatio: 100},
+			limitExceeded: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			dir := tt.TempDir()
+			archivePath := filepath.Join(dir, "archive.tar.gz")
+			writeTestTarGz(tt, archivePath, tc.entries)
+
+			dirPath := filepath.Join(dir, "archive")
+			err := NewOsCopier().Extract(archivePath, dirPath, tc.limits)
+			if err == nil {
+				tt.Fatalf("expected error")
+			}
+			if tc.limitExceeded && !errors.Is(err, ErrExtractLimitExceeded) {
+				tt.Fatalf("expected limit error, got %v", err)
+			}
+			if tc.expectedError != "" && !strings.Contains(err.Error(), tc.expectedError) {
+				tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+			}
+
+			// Nothing is left behind after a failed extraction
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if len(files) != 1 {
+				tt.Fatalf("expected only the archive to remain, got %v", files)
+			}
+		})
+	}
+}
@@ -17,10 +17,73 @@ limitations under the License.
 package file
 
 import (
+	"context"
+	"errors"
 	"io"
+	"time"
 )
 
+// ErrFreeSpaceNotSupported is returned when free space cannot be determined on the current platform
+var ErrFreeSpaceNotSupported = errors.New("free space is not supported on this platform")
+
 // Copier defines an interface that is able to copy data from a reader to a file
 type Copier interface {
 	CopyToFile(path string, reader io.Reader) (int64, error)
 }
+
+// SlicedCopier defines an interface that is able to copy data from multiple readers into different ranges of a file
+type SlicedCopier interface {
+	Copier
+	AllocateFile(path string, size int64) error
+	CopyToFileAt(path string, offset int64, reader io.Reader) (int64, error)
+}
+
+// SpaceReporter defines an interface that is able to report how much space is available for files
+type SpaceReporter interface {
+	FreeSpace(path string) (int64, error)
+	FileSize(path string) (int64, error)
+	// Filesystem returns an identifier that is the same for paths on the same filesystem
+	Filesystem(path string) (string, error)
+}
+
+// Attributes holds optional metadata about a file
+type Attributes struct {
+	Name        string
+	ModTime     time.Time
+	ContentType string
+}
+
+// AttributesCopier defines an interface that is able to copy data from a reader to a file along with its attributes
+type AttributesCopier interface {
+	Copier
+	CopyToFileWithAttributes(path string, reader io.Reader, attributes Attributes) (int64, error)
+}
+
+// ContextCopier defines an interface that is able to copy data from a reader to a file along with its attributes,
+// giving up when a context is done
+type ContextCopier interface {
+	AttributesCopier
+	CopyToFileWithContext(ctx context.Context, path string, reader io.Reader, attributes Attributes) (int64, error)
+}
+
+// ExtractLimits limits what is extracted from an archive, to protect against archives that expand to far more than
+// their own size
+type ExtractLimits struct {
+	// MaxBytes is the maximum total size of the extracted files (0=unlimited)
+	MaxBytes int64
+	// MaxFiles is the maximum number of extracted files (0=unlimited)
+	MaxFiles int
+	// MaxRatio is the maximum total size of the extracted files relative to the size of the archive (0=unlimited)
+	MaxRatio float64
+}
+
+// Extractor defines an interface that is able to unpack an archive that has been copied to a file
+type Extractor interface {
+	Extract(archivePath, dirPath string, limits ExtractLimits) error
+	Remove(path string) error
+}
+
+// Checksummer defines an interface that is able to compute the checksum of a file that data has been copied to
+type Checksummer interface {
+	FileCRC32C(path string) (uint32, error)
+}
@@ -29,3 +29,74 @@ type MockCopier struct {
 func (c *MockCopier) CopyToFile(path string, reader io.Reader) (int64, error) {
 	return c.CopyToFileImplementation(path, reader)
 }
+
+// MockSlicedCopier provides a mock implementation of the SlicedCopier interface
+type MockSlicedCopier struct {
+	MockCopier
+	AllocateFileImplementation func(path string, size int64) error
+	CopyToFileAtImplementation func(path string, offset int64, reader io.Reader) (int64, error)
+}
+
+// AllocateFile creates a file of the specified size
+func (c *MockSlicedCopier) AllocateFile(path string, size int64) error {
+	return c.AllocateFileImplementation(path, size)
+}
+
+// CopyToFileAt copies data from a reader into a file, starting at the specified offset
+func (c *MockSlicedCopier) CopyToFileAt(path string, offset int64, reader io.Reader) (int64, error) {
+	return c.CopyToFileAtImplementation(path, offset, reader)
+}
+
+// MockSpaceCopier provides a mock implementation of the Copier and SpaceReporter interfaces
+type MockSpaceCopier struct {
+	MockCopier
+	FreeSpaceImplementation  func(path string) (int64, error)
+	FileSizeImplementation   func(path string) (int64, error)
+	FilesystemImplementation func(path string) (string, error)
+}
+
+// FreeSpace returns the number of bytes available for a path
+func (c *MockSpaceCopier) FreeSpace(path string) (int64, error) {
+	return c.FreeSpaceImplementation(path)
+}
+
+// FileSize returns the size of an existing file
+func (c *MockSpaceCopier) FileSize(path string) (int64, error) {
+	return c.FileSizeImplementation(path)
+}
+
+// Filesystem returns the filesystem of a path, which is the path itself unless there is a FilesystemImplementation
+func (c *MockSpaceCopier) Filesystem(path string) (string, error) {
+	if c.FilesystemImplementation == nil {
+		return path, nil
+	}
+	return c.FilesystemImplementation(path)
+}
+
+// MockExtractCopier provides a mock implementation of the Copier and Extractor interfaces
+type MockExtractCopier struct {
+	MockCopier
+	ExtractImplementation func(archivePath, dirPath string, limits ExtractLimits) error
+	RemoveImplementation  func(path string) error
+}
+
+// Extract unpacks an archive into a directory
+func (c *MockExtractCopier) Extract(archivePath, dirPath string, limits ExtractLimits) error {
+	return c.ExtractImplementation(archivePath, dirPath, limits)
+}
+
+// Remove deletes a file
+func (c *MockExtractCopier) Remove(path string) error {
+	return c.RemoveImplementation(path)
+}
+
+// MockChecksumCopier provides a mock implementation of the Copier and Checksummer interfaces
+type MockChecksumCopier struct {
+	MockCopier
+	FileCRC32CImplementation func(path string) (uint32, error)
+}
+
+// FileCRC32C computes the checksum of a file
+func (c *MockChecksumCopier) FileCRC32C(path string) (uint32, error) {
+	return c.FileCRC32CImplementation(path)
+}
@@ -22,10 +22,13 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+
+	"github.com/brianpursley/gsdownload/cmd/checksum"
 )
 
 var (
 	osCreate   = os.Create
+	osOpenFile = os.OpenFile
 	osMkdirAll = os.MkdirAll
 	ioCopy     = io.Copy
 )
@@ -62,8 +65,121 @@ func (c *OsCopier) CopyToFile(path string, reader io.Reader) (int64, error) {
 	return bytes, nil
 }
 
+// AllocateFile creates a file of the specified size, so that ranges of it can be written by CopyToFileAt
+func (c *OsCopier) AllocateFile(path string, size int64) error {
+	dirPath := filepath.Dir(path)
+	err := c.safeMkdirAll(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dirPath, err)
+	}
+
+	file, err := osOpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	if err := file.Truncate(size); err != nil {
+		return fmt.Errorf("failed to allocate file %s: %v", path, err)
+	}
+	return nil
+}
+
+// CopyToFileAt copies data from a reader into an existing file, starting at the specified offset
+func (c *OsCopier) CopyToFileAt(path string, offset int64, reader io.Reader) (int64, error) {
+	file, err := osOpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	bytes, err := ioCopy(&offsetWriter{writer: file, offset: offset}, reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed writing to file %s: %v", path, err)
+	}
+
+	return bytes, nil
+}
+
+// FreeSpace returns the number of bytes available on the filesystem where a path is or would be created
+func (c *OsCopier) FreeSpace(path string) (int64, error) {
+	path, err := nearestExistingPath(path)
+	if err != nil {
+		return 0, err
+	}
+	return freeSpace(path)
+}
+
+// Filesystem returns an identifier of the filesystem where a path is or would be created
+func (c *OsCopier) Filesystem(path string) (string, error) {
+	path, err := nearestExistingPath(path)
+	if err != nil {
+		return "", err
+	}
+	return filesystem(path)
+}
+
+// nearestExistingPath returns the absolute path of a path, or of its nearest parent directory that exists, since the
+// path may not have been created yet
+func nearestExistingPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			return path, nil
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// FileSize returns the size of an existing file, or zero if the file does not exist
+func (c *OsCopier) FileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// FileCRC32C computes the CRC32C checksum of an existing file, by reading it back from disk
+func (c *OsCopier) FileCRC32C(path string) (uint32, error) {
+	return CRC32C(path)
+}
+
+// CRC32C computes the CRC32C checksum of a file's content
+func CRC32C(path string) (uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	hash := checksum.NewCRC32C()
+	if _, err := io.Copy(hash, file); err != nil {
+		return 0, fmt.Errorf("failed reading file %s: %v", path, err)
+	}
+	return hash.Sum32(), nil
+}
+
 func (c *OsCopier) safeMkdirAll(path string) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	return osMkdirAll(path, 0755)
 }
+
+// offsetWriter writes sequentially to a WriterAt, starting at an offset
+type offsetWriter struct {
+	writer io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
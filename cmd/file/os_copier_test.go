@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -75,3 +76,86 @@ func TestCopyToFileCreatesAFile(t *testing.T) {
 		t.Fatalf("wrong content: expected %q, got %q", content, string(bytesCopied))
 	}
 }
+
+func TestCopyToFileAtWritesRanges(t *testing.T) {
+	osOpenFile = os.OpenFile
+	osMkdirAll = os.MkdirAll
+	ioCopy = io.Copy
+
+	path := filepath.Join(t.TempDir(), "foo", "bar")
+	copier := NewOsCopier()
+	if err := copier.AllocateFile(path, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copier.CopyToFileAt(path, 5, bytes.NewReader([]byte("56789"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copier.CopyToFileAt(path, 0, bytes.NewReader([]byte("01234"))); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "0123456789" {
+		t.Fatalf("wrong content: expected %q, got %q", "0123456789", string(content))
+	}
+}
+
+func TestFreeSpaceAndFileSize(t *testing.T) {
+	dir := t.TempDir()
+	copier := NewOsCopier()
+
+	// The output directory may not exist yet
+	free, err := copier.FreeSpace(filepath.Join(dir, "foo", "bar"))
+	if err != nil && err != ErrFreeSpaceNotSupported {
+		t.Fatal(err)
+	}
+	if err == nil && free <= 0 {
+		t.Fatalf("expected free space to be greater than zero, got %d", free)
+	}
+
+	// Directories that don't exist yet are on the same filesystem as their parent
+	fs1, err := copier.Filesystem(filepath.Join(dir, "foo", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs2, err := copier.Filesystem(dir)
+	if err != nil || fs1 != fs2 {
+		t.Fatalf("expected the same filesystem, got %q and %q, %v", fs1, fs2, err)
+	}
+
+	size, err := copier.FileSize(filepath.Join(dir, "missing"))
+	if err != nil || size != 0 {
+		t.Fatalf("expected zero size for missing file, got %d, %v", size, err)
+	}
+	path := filepath.Join(dir, "existing")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	size, err = copier.FileSize(path)
+	if err != nil || size != 7 {
+		t.Fatalf("expected size 7 for existing file, got %d, %v", size, err)
+	}
+}
+
+func TestFileCRC32CReadsTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	crc32c, err := NewOsCopier().FileCRC32C(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The standard check value for CRC-32C
+	if crc32c != 0xe3069283 {
+		t.Fatalf("wrong checksum: expected %08x, got %08x", 0xe3069283, crc32c)
+	}
+
+	if _, err := NewOsCopier().FileCRC32C(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expected error for a missing file")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !darwin && !freebsd && !linux && !windows
+// +build !darwin,!freebsd,!linux,!windows
+
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+// freeSpace is not supported on this platform
+func freeSpace(path string) (int64, error) {
+	return 0, ErrFreeSpaceNotSupported
+}
+
+// filesystem treats each path as a separate filesystem, since free space is not supported on this platform anyway
+func filesystem(path string) (string, error) {
+	return path, nil
+}
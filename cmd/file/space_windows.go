@@ -0,0 +1,50 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace returns the number of bytes available to the current user on the volume containing a path
+func freeSpace(path string) (int64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var freeBytesAvailable uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(freeBytesAvailable), nil
+}
+
+// filesystem returns the root of the volume containing a path, such as C:\
+func filesystem(path string) (string, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	volume := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumePathName(pathPtr, &volume[0], uint32(len(volume))); err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(volume), nil
+}
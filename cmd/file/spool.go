@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spoolMemoryLimit is the amount of data that is buffered in memory before spilling to a temporary file
+var spoolMemoryLimit int64 = 8 << 20
+
+// spool holds the data read from a reader, so that it can be written somewhere else once its size is known
+type spool struct {
+	buffer bytes.Buffer
+	file   *os.File
+	size   int64
+}
+
+// newSpool reads all data from a reader into memory, or into a temporary file if there is too much to keep in memory
+func newSpool(reader io.Reader) (*spool, error) {
+	s := &spool{}
+	n, err := io.CopyN(&s.buffer, reader, spoolMemoryLimit+1)
+	s.size = n
+	if err == io.EOF {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.file, err = os.CreateTemp("", "gsdownload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	// The file is only needed until the spool is closed, so remove its name right away
+	_ = os.Remove(s.file.Name())
+
+	if _, err := s.file.Write(s.buffer.Bytes()); err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.buffer = bytes.Buffer{}
+	n, err = io.Copy(s.file, reader)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.size += n
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *spool) Read(p []byte) (int, error) {
+	if s.file != nil {
+		return s.file.Read(p)
+	}
+	return s.buffer.Read(p)
+}
+
+func (s *spool) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compressions that a TarCopier can apply to the archive it writes
+const (
+	// CompressionNone writes an uncompressed tar archive
+	CompressionNone = ""
+	// CompressionGzip compresses the tar archive with gzip
+	CompressionGzip = "gzip"
+	// CompressionZstd compresses the tar archive with zstd
+	CompressionZstd = "zstd"
+)
+
+// TarCopier provides the ability to copy data into entries of a single tar archive.
+// The data for each entry is buffered until it has all been read, so that files can be copied concurrently while
+// entries are written to the archive one at a time.
+type TarCopier struct {
+	root       string
+	mutex      sync.Mutex
+	output     io.WriteCloser
+	compressor io.WriteCloser
+	writer     *tar.Writer
+}
+
+// NewTarCopier creates a new TarCopier instance that writes an archive to output, optionally compressed.
+// Entries are named by their path relative to root.
+func NewTarCopier(output io.WriteCloser, root string, compression string) (*TarCopier, error) {
+	c := &TarCopier{root: root, output: output}
+	var writer io.Writer = output
+	switch compression {
+	case CompressionNone:
+	case CompressionGzip:
+		c.compressor = gzip.NewWriter(output)
+		writer = c.compressor
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(output)
+		if err != nil {
+			return nil, err
+		}
+		c.compressor = encoder
+		writer = c.compressor
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	c.writer = tar.NewWriter(writer)
+	return c, nil
+}
+
+// CopyToFile copies data from a reader to an entry in the archive
+func (c *TarCopier) CopyToFile(path string, reader io.Reader) (int64, error) {
+	return c.CopyToFileWithAttributes(path, reader, Attributes{})
+}
+
+// CopyToFileWithAttributes copies data from a reader to an entry in the archive, using the attributes for its header
+func (c *TarCopier) CopyToFileWithAttributes(path string, reader io.Reader, attributes Attributes) (int64, error) {
+	name, err := entryName(c.root, path)
+	if err != nil {
+		return 0, err
+	}
+
+	s, err := newSpool(reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed reading data for %s: %v", name, err)
+	}
+	defer s.Close()
+
+	modTime := attributes.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     s.size,
+		Mode:     0644,
+		ModTime:  modTime,
+	}
+	if err := c.writer.WriteHeader(header); err != nil {
+		return 0, fmt.Errorf("failed writing header for %s: %v", name, err)
+	}
+	bytes, err := io.Copy(c.writer, s)
+	if err != nil {
+		return 0, fmt.Errorf("failed writing to archive entry %s: %v", name, err)
+	}
+	return bytes, nil
+}
+
+// Close finishes writing the archive and closes the output
+func (c *TarCopier) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.writer.Close()
+	if c.compressor != nil {
+		if compressorErr := c.compressor.Close(); err == nil {
+			err = compressorErr
+		}
+	}
+	if outputErr := c.output.Close(); err == nil {
+		err = outputErr
+	}
+	return err
+}
+
+// entryName returns the slash-separated name of an archive entry for a path beneath root
+func entryName(root, path string) (string, error) {
+	name, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", fmt.Errorf("invalid archive entry %s: %v", path, err)
+	}
+	return filepath.ToSlash(name), nil
+}
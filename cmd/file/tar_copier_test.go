@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestTarCopierWritesEntries(t *testing.T) {
+	spoolMemoryLimit = 16
+	defer func() { spoolMemoryLimit = 8 << 20 }()
+
+	modTime := time.Date(2022, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(fmt.Sprintf("compression %q", compression), func(tt *testing.T) {
+			output := &closingBuffer{}
+			copier, err := NewTarCopier(output, "root", compression)
+			if err != nil {
+				tt.Fatal(err)
+			}
+
+			// Write entries concurrently, some of which are large enough to be spooled to a temporary file
+			expected := map[string]string{}
+			wg := sync.WaitGroup{}
+			for i := 0; i < 20; i++ {
+				name := fmt.Sprintf("dir/file-%d", i)
+				content := strings.Repeat(name, i)
+				expected[name] = content
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n, err := copier.CopyToFileWithAttributes("root/"+name, strings.NewReader(content), Attributes{ModTime: modTime})
+					if err != nil || n != int64(len(content)) {
+						tt.Errorf("copy of %s failed: %d, %v", name, n, err)
+					}
+				}()
+			}
+			wg.Wait()
+			if err := copier.Close(); err != nil {
+				tt.Fatal(err)
+			}
+			if !output.closed {
+				tt.Fatalf("output should have been closed")
+			}
+
+			var reader io.Reader = &output.Buffer
+			switch compression {
+			case CompressionGzip:
+				if reader, err = gzip.NewReader(reader); err != nil {
+					tt.Fatal(err)
+				}
+			case CompressionZstd:
+				decoder, err := zstd.NewReader(reader)
+				if err != nil {
+					tt.Fatal(err)
+				}
+				defer decoder.Close()
+				reader = decoder
+			}
+
+			tarReader := tar.NewReader(reader)
+			actual := map[string]string{}
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					tt.Fatal(err)
+				}
+				if !header.ModTime.Equal(modTime) {
+					tt.Fatalf("wrong modification time for %s: expected %v, got %v", header.Name, modTime, header.ModTime)
+				}
+				content, err := io.ReadAll(tarReader)
+				if err != nil {
+					tt.Fatal(err)
+				}
+				actual[header.Name] = string(content)
+			}
+			if len(actual) != len(expected) {
+				tt.Fatalf("wrong number of entries: expected %d, got %d", len(expected), len(actual))
+			}
+			for name, content := range expected {
+				if actual[name] != content {
+					tt.Fatalf("wrong content for %s: expected %q, got %q", name, content, actual[name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"io"
+	"sync"
+)
+
+// WriterCopier provides the ability to copy the data for every file to a single writer, such as stdout.
+// Files are written one at a time, so the data for different files is never interleaved.
+type WriterCopier struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewWriterCopier creates a new WriterCopier instance
+func NewWriterCopier(writer io.Writer) *WriterCopier {
+	return &WriterCopier{writer: writer}
+}
+
+// CopyToFile copies data from a reader to the writer
+func (c *WriterCopier) CopyToFile(_ string, reader io.Reader) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return io.Copy(c.writer, reader)
+}
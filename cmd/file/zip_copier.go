@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ZipCopier provides the ability to copy data into entries of a single zip archive.
+// Entries are deflated unless their content type matches one of the store patterns, such as image/*, since data that
+// is already compressed gains little from being compressed again. Zip64 records are written for entries larger than
+// 4GiB.
+// The data for each entry is buffered until it has all been read, so that files can be copied concurrently while
+// entries are written to the archive one at a time.
+type ZipCopier struct {
+	root          string
+	storePatterns []string
+	mutex         sync.Mutex
+	output        io.WriteCloser
+	writer        *zip.Writer
+}
+
+// NewZipCopier creates a new ZipCopier instance that writes an archive to output.
+// Entries are named by their path relative to root.
+func NewZipCopier(output io.WriteCloser, root string, storePatterns []string) *ZipCopier {
+	return &ZipCopier{
+		root:          root,
+		storePatterns: storePatterns,
+		output:        output,
+		writer:        zip.NewWriter(output),
+	}
+}
+
+// CopyToFile copies data from a reader to an entry in the archive
+func (c *ZipCopier) CopyToFile(path string, reader io.Reader) (int64, error) {
+	return c.CopyToFileWithAttributes(path, reader, Attributes{})
+}
+
+// CopyToFileWithAttributes copies data from a reader to an entry in the archive, using the attributes for its header
+func (c *ZipCopier) CopyToFileWithAttributes(path string, reader io.Reader, attributes Attributes) (int64, error) {
+	name, err := entryName(c.root, path)
+	if err != nil {
+		return 0, err
+	}
+
+	s, err := newSpool(reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed reading data for %s: %v", name, err)
+	}
+	defer s.Close()
+
+	modTime := attributes.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	method := zip.Deflate
+	if c.isStored(attributes.ContentType) {
+		method = zip.Store
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: modTime,
+	}
+	header.SetMode(0644)
+	writer, err := c.writer.CreateHeader(header)
+	if err != nil {
+		return 0, fmt.Errorf("failed writing header for %s: %v", name, err)
+	}
+	bytes, err := io.Copy(writer, s)
+	if err != nil {
+		return 0, fmt.Errorf("failed writing to archive entry %s: %v", name, err)
+	}
+	return bytes, nil
+}
+
+// Close finishes writing the archive and closes the output
+func (c *ZipCopier) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.writer.Close()
+	if outputErr := c.output.Close(); err == nil {
+		err = outputErr
+	}
+	return err
+}
+
+// isStored returns true if data with a content type should be stored without compression
+func (c *ZipCopier) isStored(contentType string) bool {
+	// Ignore parameters, such as the charset in "text/plain; charset=utf-8"
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	if mediaType == "" {
+		return false
+	}
+	for _, pattern := range c.storePatterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), mediaType); matched {
+			return true
+		}
+	}
+	return false
+}
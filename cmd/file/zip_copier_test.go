@@ -0,0 +1,80 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestZipCopierWritesEntries(t *testing.T) {
+	modTime := time.Date(2022, 2, 3, 4, 5, 6, 0, time.UTC)
+	output := &closingBuffer{}
+	copier := NewZipCopier(output, "root", []string{"image/*", "application/zip"})
+
+	entries := []struct {
+		name           string
+		contentType    string
+		expectedMethod uint16
+	}{
+		{name: "foo.txt", contentType: "text/plain; charset=utf-8", expectedMethod: zip.Deflate},
+		{name: "dir/bar.png", contentType: "image/png", expectedMethod: zip.Store},
+		{name: "dir/baz.zip", contentType: "Application/Zip", expectedMethod: zip.Store},
+		{name: "unknown", expectedMethod: zip.Deflate},
+	}
+	for _, entry := range entries {
+		attributes := Attributes{ModTime: modTime, ContentType: entry.contentType}
+		if _, err := copier.CopyToFileWithAttributes("root/"+entry.name, bytes.NewReader([]byte(entry.name)), attributes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := copier.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != len(entries) {
+		t.Fatalf("wrong number of entries: expected %d, got %d", len(entries), len(reader.File))
+	}
+	for i, f := range reader.File {
+		entry := entries[i]
+		if f.Name != entry.name {
+			t.Fatalf("wrong name: expected %q, got %q", entry.name, f.Name)
+		}
+		if f.Method != entry.expectedMethod {
+			t.Fatalf("wrong method for %s: expected %d, got %d", entry.name, entry.expectedMethod, f.Method)
+		}
+		if !f.Modified.Equal(modTime) {
+			t.Fatalf("wrong modification time for %s: expected %v, got %v", entry.name, modTime, f.Modified)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(content) != entry.name {
+			t.Fatalf("wrong content for %s: got %q", entry.name, content)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/checksum"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+const (
+	// hedgeChunkSize is the size of the chunks read from each source of a hedged reader
+	hedgeChunkSize = 32 * 1024
+	// hedgeLagLimit is how far a source can fall behind the fastest source before it is abandoned
+	hedgeLagLimit = 8 * 1024 * 1024
+	// throughputSampleCount is the number of completed downloads used to compute the median throughput
+	throughputSampleCount = 100
+	// throughputMinSamples is the number of completed downloads required before slow downloads are hedged
+	throughputMinSamples = 3
+)
+
+var (
+	// hedgeGracePeriod is how long a download runs before its throughput is compared against the median
+	hedgeGracePeriod = 5 * time.Second
+	// hedgeCheckInterval is how often the throughput of a download is compared against the median
+	hedgeCheckInterval = time.Second
+)
+
+// throughputTracker records the throughput of recently completed downloads
+type throughputTracker struct {
+	mutex   sync.Mutex
+	samples []float64
+}
+
+func (t *throughputTracker) record(bytes int64, elapsed time.Duration) {
+	if bytes <= 0 || elapsed <= 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.samples = append(t.samples, float64(bytes)/elapsed.Seconds())
+	if len(t.samples) > throughputSampleCount {
+		t.samples = t.samples[1:]
+	}
+}
+
+// median returns the median throughput in bytes per second, or zero if there are not enough samples
+func (t *throughputTracker) median() float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.samples) < throughputMinSamples {
+		return 0
+	}
+	sorted := append([]float64{}, t.samples...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// hedgedReader reads an object from a primary reader, and if the transfer stalls or falls far below the median
+// throughput, starts a second read of the remaining range. Both reads then run concurrently, the reader returns data
+// from whichever is furthest ahead, and a read that falls too far behind is abandoned.
+// Both reads must be of the same generation of the object, and the checksum of the data that is returned is compared
+// with the object's checksum at the end, since range reads are not checked by the storage client.
+type hedgedReader struct {
+	ctx    context.Context
+	runner *runner
+	obj    *storage.ObjectInfo
+
+	chunks       chan hedgeChunk
+	sources      map[*hedgeSource]bool
+	hedged       bool
+	offset       int64
+	hash         hash.Hash32
+	pending      []byte
+	err          error
+	start        time.Time
+	lastProgress time.Time
+	nextCheck    time.Time
+}
+
+type hedgeSource struct {
+	reader io.ReadCloser
+	stop   chan bool
+	offset int64
+}
+
+type hedgeChunk struct {
+	source *hedgeSource
+	offset int64
+	data   []byte
+	err    error
+}
+
+func (r *runner) newHedgedReader(ctx context.Context, obj *storage.ObjectInfo, reader io.ReadCloser) *hedgedReader {
+	now := time.Now()
+	h := &hedgedReader{
+		ctx:          ctx,
+		runner:       r,
+		obj:          obj,
+		chunks:       make(chan hedgeChunk),
+		sources:      map[*hedgeSource]bool{},
+		hash:         checksum.NewCRC32C(),
+		start:        now,
+		lastProgress: now,
+		nextCheck:    now.Add(hedgeCheckInterval),
+	}
+	h.addSource(reader, 0)
+	return h
+}
+
+func (h *hedgedReader) addSource(reader io.ReadCloser, offset int64) {
+	s := &hedgeSource{reader: reader, stop: make(chan bool), offset: offset}
+	h.sources[s] = true
+	go func() {
+		for {
+			buf := make([]byte, hedgeChunkSize)
+			n, err := s.reader.Read(buf)
+			if n > 0 || err != nil {
+				select {
+				case h.chunks <- hedgeChunk{source: s, offset: offset, data: buf[:n], err: err}:
+				case <-s.stop:
+					return
+				}
+			}
+			offset += int64(n)
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func (h *hedgedReader) stopSource(s *hedgeSource) {
+	if h.sources[s] {
+		delete(h.sources, s)
+		close(s.stop)
+		_ = s.reader.Close()
+	}
+}
+
+func (h *hedgedReader) Read(p []byte) (int, error) {
+	for len(h.pending) == 0 {
+		if h.err != nil {
+			return 0, h.err
+		}
+		h.receive()
+	}
+	n := copy(p, h.pending)
+	h.pending = h.pending[n:]
+	return n, nil
+}
+
+// Close stops all reads that are still in progress
+func (h *hedgedReader) Close() error {
+	for s := range h.sources {
+		h.stopSource(s)
+	}
+	return nil
+}
+
+// receive waits until there is more data or an error, starting a hedged read if the transfer stalls or is slow
+func (h *hedgedReader) receive() {
+	var stallChan <-chan time.Time
+	if h.runner.stallTimeout > 0 {
+		stallTimer := time.NewTimer(h.runner.stallTimeout - time.Since(h.lastProgress))
+		defer stallTimer.Stop()
+		stallChan = stallTimer.C
+	}
+
+	// The check is scheduled relative to the reader rather than to this call, so that a transfer that trickles in small
+	// chunks, each of which ends the call, is still checked
+	var checkChan <-chan time.Time
+	if h.runner.hedgeRatio > 0 && !h.hedged {
+		checkTimer := time.NewTimer(time.Until(h.nextCheck))
+		defer checkTimer.Stop()
+		checkChan = checkTimer.C
+	}
+
+	for len(h.pending) == 0 && h.err == nil {
+		select {
+		case <-h.ctx.Done():
+			h.err = h.ctx.Err()
+		case chunk := <-h.chunks:
+			h.handleChunk(chunk)
+		case <-stallChan:
+			if h.hedged {
+				h.err = fmt.Errorf("download of %s stalled for %v", h.obj.Name, h.runner.stallTimeout)
+				return
+			}
+			h.startHedge("stalled")
+			// Give the hedged read a full stall timeout to make progress
+			h.lastProgress = time.Now()
+			return
+		case <-checkChan:
+			h.nextCheck = time.Now().Add(hedgeCheckInterval)
+			if h.isSlow() {
+				h.startHedge("slow")
+				return
+			}
+			checkTimer := time.NewTimer(hedgeCheckInterval)
+			defer checkTimer.Stop()
+			checkChan = checkTimer.C
+		}
+	}
+}
+
+func (h *hedgedReader) handleChunk(chunk hedgeChunk) {
+	if !h.sources[chunk.source] {
+		return
+	}
+
+	end := chunk.offset + int64(len(chunk.data))
+	if end > h.offset {
+		h.pending = chunk.data[h.offset-chunk.offset:]
+		_, _ = h.hash.Write(h.pending)
+		h.offset = end
+		h.lastProgress = time.Now()
+	}
+	chunk.source.offset = end
+
+	if chunk.err != nil {
+		if chunk.err == io.EOF && chunk.source.offset == h.offset {
+			// This source has delivered the whole object, so the others are no longer needed
+			_ = h.Close()
+			h.err = io.EOF
+			if crc32c := h.hash.Sum32(); crc32c != h.obj.CRC32C {
+				h.err = fmt.Errorf("checksum mismatch for %s: expected crc32c %08x, got %08x", h.obj.Name, h.obj.CRC32C, crc32c)
+			}
+			return
+		}
+		h.stopSource(chunk.source)
+		if len(h.sources) == 0 {
+			h.err = chunk.err
+		}
+		return
+	}
+
+	for s := range h.sources {
+		if h.offset-s.offset > hedgeLagLimit {
+			h.stopSource(s)
+		}
+	}
+}
+
+func (h *hedgedReader) isSlow() bool {
+	elapsed := time.Since(h.start)
+	if elapsed < hedgeGracePeriod {
+		return false
+	}
+	median := h.runner.throughput.median()
+	return median > 0 && float64(h.offset)/elapsed.Seconds() < median/h.runner.hedgeRatio
+}
+
+func (h *hedgedReader) startHedge(reason string) {
+	h.hedged = true
+	reader, err := h.runner.readObjectRange(h.ctx, h.obj, h.offset, -1)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: failed to start hedged read of %s: %v\n", h.obj.Name, err)
+		return
+	}
+	if h.runner.verbose {
+		h.runner.logf("%s %s at offset %d, starting hedged read\n", h.obj.Name, reason, h.offset)
+	}
+	h.addSource(reader, h.offset)
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// stallingReader returns some data and then blocks until it is closed
+type stallingReader struct {
+	data   []byte
+	closed chan bool
+}
+
+func newStallingReader(data []byte) *stallingReader {
+	return &stallingReader{data: data, closed: make(chan bool)}
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	<-r.closed
+	return 0, fmt.Errorf("reader closed")
+}
+
+func (r *stallingReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+// tricklingReader returns one byte at a time at an interval, and then blocks until it is closed
+type tricklingReader struct {
+	stallingReader
+	interval time.Duration
+}
+
+func (r *tricklingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		time.Sleep(r.interval)
+		return r.stallingReader.Read(p[:1])
+	}
+	return r.stallingReader.Read(p)
+}
+
+func TestHedgedReaderShouldHedgeStalledRead(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	testCases := map[string]struct {
+		hedgeStalls bool
+		expectError bool
+	}{
+		"hedged read completes": {},
+		"hedged read stalls":    {hedgeStalls: true, expectError: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			if tc.hedgeStalls {
+				storageClient = &hedgeStallingClient{}
+			} else {
+				storageClient = &storage.MockClient{
+					ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+						return data
+					},
+				}
+			}
+			r := &runner{bucketName: "bucket", stallTimeout: 50 * time.Millisecond}
+			obj := &storage.ObjectInfo{Name: "prefix/foo", Size: int64(len(data)), CRC32C: crc32cForTest(data)}
+			h := r.newHedgedReader(context.Background(), obj, newStallingReader(data[:40000]))
+
+			actual, err := io.ReadAll(h)
+			_ = h.Close()
+			if tc.expectError {
+				if err == nil {
+					tt.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("read failed: %v", err)
+			}
+			if !bytes.Equal(actual, data) {
+				tt.Fatalf("wrong data: expected %d bytes, got %d bytes", len(data), len(actual))
+			}
+		})
+	}
+}
+
+func TestHedgedReaderShouldHedgeSlowRead(t *testing.T) {
+	hedgeGracePeriod = 10 * time.Millisecond
+	hedgeCheckInterval = 10 * time.Millisecond
+	defer func() {
+		hedgeGracePeriod = 5 * time.Second
+		hedgeCheckInterval = time.Second
+	}()
+
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	storageClient = &storage.MockClient{
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return data
+		},
+	}
+	r := &runner{bucketName: "bucket", hedgeRatio: 10}
+	for i := 0; i < throughputMinSamples; i++ {
+		r.throughput.record(1<<30, time.Second)
+	}
+
+	obj := &storage.ObjectInfo{Name: "prefix/foo", Size: int64(len(data)), CRC32C: crc32cForTest(data)}
+	h := r.newHedgedReader(context.Background(), obj, newStallingReader(data[:4]))
+	actual, err := io.ReadAll(h)
+	_ = h.Close()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(actual, data) {
+		t.Fatalf("wrong data: expected %q, got %q", data, actual)
+	}
+}
+
+func TestHedgedReaderShouldHedgeTricklingRead(t *testing.T) {
+	hedgeGracePeriod = 10 * time.Millisecond
+	hedgeCheckInterval = 50 * time.Millisecond
+	defer func() {
+		hedgeGracePeriod = 5 * time.Second
+		hedgeCheckInterval = time.Second
+	}()
+
+	// Without hedging, reading this a byte at a time would take far longer than the timeout
+	data := bytes.Repeat([]byte("0123456789"), 500)
+	storageClient = &storage.MockClient{
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return data
+		},
+	}
+	r := &runner{bucketName: "bucket", hedgeRatio: 10}
+	for i := 0; i < throughputMinSamples; i++ {
+		r.throughput.record(1<<30, time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	obj := &storage.ObjectInfo{Name: "prefix/foo", Size: int64(len(data)), CRC32C: crc32cForTest(data)}
+	primary := &tricklingReader{stallingReader: *newStallingReader(data), interval: 2 * time.Millisecond}
+	h := r.newHedgedReader(ctx, obj, primary)
+	actual, err := io.ReadAll(h)
+	_ = h.Close()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(actual, data) {
+		t.Fatalf("wrong data")
+	}
+}
+
+func TestHedgedReaderShouldFailWhenSplicedDataHasWrongChecksum(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	// The hedged read returns different data than the first read, such as from another generation of the object
+	other := append([]byte{}, data...)
+	other[len(other)-1]++
+	storageClient = &storage.MockClient{
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return other
+		},
+	}
+	r := &runner{bucketName: "bucket", stallTimeout: 50 * time.Millisecond}
+	obj := &storage.ObjectInfo{Name: "prefix/foo", Size: int64(len(data)), CRC32C: crc32cForTest(data)}
+	h := r.newHedgedReader(context.Background(), obj, newStallingReader(data[:40000]))
+	_, err := io.ReadAll(h)
+	_ = h.Close()
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+// generationRecordingClient records the generation of each range read
+type generationRecordingClient struct {
+	storage.MockClient
+	mutex       sync.Mutex
+	generations []int64
+}
+
+func (c *generationRecordingClient) ReadObjectRange(ctx context.Context, bucketName, objectName string, generation, offset, length int64) (io.ReadCloser, error) {
+	c.mutex.Lock()
+	c.generations = append(c.generations, generation)
+	c.mutex.Unlock()
+	return c.MockClient.ReadObjectRange(ctx, bucketName, objectName, generation, offset, length)
+}
+
+func TestCommandShouldHedgeOnlyUnencodedObjectsAtTheListedGeneration(t *testing.T) {
+	testCases := map[string]struct {
+		contentEncoding     string
+		expectedGenerations string
+	}{
+		"unencoded": {expectedGenerations: "7"},
+		"gzip":      {contentEncoding: "gzip", expectedGenerations: ""},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			content := []byte("content")
+			client := &generationRecordingClient{
+				MockClient: storage.MockClient{
+					ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+						return []storage.ObjectInfo{{Name: "prefix/a", Size: int64(len(content)), Generation: 7, CRC32C: crc32cForTest(content), ContentEncoding: tc.contentEncoding}}
+					},
+					ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+						return content
+					},
+				},
+			}
+			storageClient = client
+			fileCopier = &file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					return io.Copy(io.Discard, reader)
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path", "--stall-timeout", "1m"})
+			if err := command.Execute(); err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			var generations []string
+			for _, generation := range client.generations {
+				generations = append(generations, strconv.FormatInt(generation, 10))
+			}
+			if strings.Join(generations, ",") != tc.expectedGenerations {
+				tt.Fatalf("wrong range reads: expected generations %q, got %q", tc.expectedGenerations, generations)
+			}
+		})
+	}
+}
+
+func TestThroughputTrackerMedian(t *testing.T) {
+	tracker := throughputTracker{}
+	tracker.record(100, time.Second)
+	tracker.record(300, time.Second)
+	if median := tracker.median(); median != 0 {
+		t.Fatalf("median should be zero until there are enough samples, got %v", median)
+	}
+	tracker.record(200, time.Second)
+	if median := tracker.median(); median != 200 {
+		t.Fatalf("wrong median: expected 200, got %v", median)
+	}
+}
+
+// hedgeStallingClient is a client whose range reads stall immediately
+type hedgeStallingClient struct {
+	storage.MockClient
+}
+
+func (c *hedgeStallingClient) ReadObjectRange(_ context.Context, _, _ string, _, _, _ int64) (io.ReadCloser, error) {
+	return newStallingReader(nil), nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/brianpursley/gsdownload/cmd/shell"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+const (
+	hookErrorsFail   = "fail"
+	hookErrorsIgnore = "ignore"
+)
+
+var hookPlaceholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// hookPlaceholders are the placeholders that can be used in an --on-object command
+var hookPlaceholders = []string{"path", "name", "size", "generation", "crc32c", "content_type"}
+
+// validateHook returns an error if a command uses a placeholder that doesn't exist
+func validateHook(commandLine string) error {
+	for _, match := range hookPlaceholderPattern.FindAllStringSubmatch(commandLine, -1) {
+		if !isHookPlaceholder(match[1]) {
+			return fmt.Errorf("unknown placeholder {%s} in --on-object, must be one of %v", match[1], hookPlaceholders)
+		}
+	}
+	return nil
+}
+
+func isHookPlaceholder(name string) bool {
+	for _, placeholder := range hookPlaceholders {
+		if placeholder == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runHook runs the --on-object command for a downloaded object, with placeholders replaced by quoted values and the
+// same values available in environment variables
+func (r *runner) runHook(ctx context.Context, obj *storage.ObjectInfo) error {
+	values := map[string]string{
+		"path":         r.getPathForObject(obj.Name),
+		"name":         obj.Name,
+		"size":         strconv.FormatInt(obj.Size, 10),
+		"generation":   strconv.FormatInt(obj.Generation, 10),
+		"crc32c":       fmt.Sprintf("%08x", obj.CRC32C),
+		"content_type": obj.ContentType,
+	}
+	var quoteErr error
+	commandLine := hookPlaceholderPattern.ReplaceAllStringFunc(r.onObject, func(placeholder string) string {
+		quoted, err := shell.Quote(values[placeholder[1:len(placeholder)-1]])
+		if err != nil && quoteErr == nil {
+			quoteErr = fmt.Errorf("cannot replace %s in --on-object for %s: %v (use the GSDOWNLOAD_ environment variables instead)", placeholder, obj.Name, err)
+		}
+		return quoted
+	})
+	if quoteErr != nil {
+		return quoteErr
+	}
+
+	cmd := shell.Command(ctx, commandLine,
+		"GSDOWNLOAD_PATH="+values["path"],
+		"GSDOWNLOAD_OBJECT="+values["name"],
+		"GSDOWNLOAD_SIZE="+values["size"],
+		"GSDOWNLOAD_GENERATION="+values["generation"],
+		"GSDOWNLOAD_CRC32C="+values["crc32c"],
+		"GSDOWNLOAD_CONTENT_TYPE="+values["content_type"],
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	r.hookSem.acquire()
+	defer r.hookSem.release()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("--on-object command failed for %s: %v", obj.Name, err)
+	}
+	return nil
+}
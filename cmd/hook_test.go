@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestCommandShouldRunHookForEachObject(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands use a POSIX shell")
+	}
+
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{
+				{Name: "prefix/foo", Size: 3, Generation: 7, CRC32C: 0xabcd},
+				{Name: "prefix/it's $(weird)", Size: 5},
+			}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+	fileCopier = &file.MockCopier{
+		CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+			return io.Copy(io.Discard, reader)
+		},
+	}
+
+	testCases := map[string]struct {
+		hook          string
+		hookErrors    string
+		expectedLines []string
+		expectedError string
+	}{
+		"placeholders": {
+			hook:          `echo {name} {path} {size} {generation} {crc32c} >> "$HOOK_LOG"`,
+			expectedLines: []string{"prefix/foo path/foo 3 7 0000abcd", "prefix/it's $(weird) path/it's $(weird) 5 0 00000000"},
+		},
+		"environment variables": {
+			hook:          `echo "$GSDOWNLOAD_OBJECT" "$GSDOWNLOAD_SIZE" >> "$HOOK_LOG"`,
+			expectedLines: []string{"prefix/foo 3", "prefix/it's $(weird) 5"},
+		},
+		"failure": {
+			hook:          "exit 1",
+			expectedError: "--on-object command failed",
+		},
+		"ignored failure": {
+			hook:       "exit 1",
+			hookErrors: hookErrorsIgnore,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			hookLog := filepath.Join(tt.TempDir(), "log")
+			tt.Setenv("HOOK_LOG", hookLog)
+
+			args := []string{"bucket", "prefix", "path", "--on-object", tc.hook}
+			if tc.hookErrors != "" {
+				args = append(args, "--hook-errors", tc.hookErrors)
+			}
+			command := NewCommand()
+			command.SetArgs(args)
+			err := command.Execute()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			if tc.expectedLines == nil {
+				return
+			}
+
+			content, err := os.ReadFile(hookLog)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+			sort.Strings(lines)
+			if strings.Join(lines, "\n") != strings.Join(tc.expectedLines, "\n") {
+				tt.Fatalf("wrong hook output: expected %q, got %q", tc.expectedLines, lines)
+			}
+		})
+	}
+}
+
+func TestConfigureHookValidation(t *testing.T) {
+	testCases := map[string]*runner{
+		"unknown placeholder":  {onObject: "echo {bogus}"},
+		"invalid hook errors":  {onObject: "true", hookErrors: "bogus"},
+		"with archive":         {onObject: "true", archive: "tar"},
+		"negative concurrency": {onObject: "true", hookConcurrency: -1},
+	}
+	for name, r := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			if err := r.configure(NewCommand(), []string{"bucket", "prefix", "path"}); err == nil {
+				tt.Fatalf("expected error")
+			}
+		})
+	}
+}
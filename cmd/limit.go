@@ -0,0 +1,78 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+const (
+	limitModeError    = "error"
+	limitModeTruncate = "truncate"
+)
+
+// errLimitReached is returned by the listing visitor to stop listing once enough objects have been found
+var errLimitReached = errors.New("limit reached")
+
+// exceedsLimits returns an error if a number of objects or bytes is over --max-objects or --max-bytes
+func (r *runner) exceedsLimits(objectCount int, byteCount int64) error {
+	if r.maxObjects > 0 && objectCount > r.maxObjects {
+		return fmt.Errorf("exceeded the maximum number of objects")
+	}
+	if r.maxBytes > 0 && byteCount > int64(r.maxBytes) {
+		return fmt.Errorf("exceeded the maximum number of bytes")
+	}
+	return nil
+}
+
+// isListedInOrder returns true if objects are visited in name order, so that listing can stop as soon as the limits
+// are reached when truncating
+func (r *runner) isListedInOrder() bool {
+	return r.listShards <= 1 && r.maxDepth == 0 && r.newest == 0 && r.sampleCount == 0
+}
+
+// selectObjects applies --newest, --max-objects and --max-bytes to a list of objects sorted by name, and returns the
+// selected objects sorted by name
+func (r *runner) selectObjects(objects []*storage.ObjectInfo) ([]*storage.ObjectInfo, error) {
+	if r.newest > 0 {
+		// The most recently updated objects come first, so truncation keeps the newest objects that fit
+		sort.SliceStable(objects, func(i, j int) bool { return objects[i].Updated.After(objects[j].Updated) })
+		if len(objects) > r.newest {
+			objects = objects[:r.newest]
+		}
+	}
+
+	var byteCount int64
+	for i, obj := range objects {
+		byteCount += obj.Size
+		if err := r.exceedsLimits(i+1, byteCount); err != nil {
+			if r.limitMode != limitModeTruncate {
+				return nil, err
+			}
+			r.truncated = true
+			objects = objects[:i]
+			break
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestSelectObjects(t *testing.T) {
+	now := time.Now()
+	objects := []*storage.ObjectInfo{
+		{Name: "a", Size: 10, Updated: now.Add(2 * time.Minute)},
+		{Name: "b", Size: 20, Updated: now},
+		{Name: "c", Size: 30, Updated: now.Add(time.Minute)},
+		{Name: "d", Size: 40, Updated: now.Add(3 * time.Minute)},
+	}
+	testCases := map[string]struct {
+		runner        *runner
+		expected      []string
+		expectedError string
+	}{
+		"no limits":                   {runner: &runner{}, expected: []string{"a", "b", "c", "d"}},
+		"max objects error":           {runner: &runner{maxObjects: 3}, expectedError: "exceeded the maximum number of objects"},
+		"max bytes error":             {runner: &runner{maxBytes: 50}, expectedError: "exceeded the maximum number of bytes"},
+		"max objects truncate":        {runner: &runner{maxObjects: 3, limitMode: limitModeTruncate}, expected: []string{"a", "b", "c"}},
+		"max bytes truncate":          {runner: &runner{maxBytes: 60, limitMode: limitModeTruncate}, expected: []string{"a", "b", "c"}},
+		"newest":                      {runner: &runner{newest: 2}, expected: []string{"a", "d"}},
+		"newest with max bytes":       {runner: &runner{newest: 3, maxBytes: 50, limitMode: limitModeTruncate}, expected: []string{"a", "d"}},
+		"newest within max objects":   {runner: &runner{newest: 2, maxObjects: 2}, expected: []string{"a", "d"}},
+		"newest exceeds max objects":  {runner: &runner{newest: 3, maxObjects: 2}, expectedError: "exceeded the maximum number of objects"},
+		"truncate without any limits": {runner: &runner{limitMode: limitModeTruncate}, expected: []string{"a", "b", "c", "d"}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			selected, err := tc.runner.selectObjects(append([]*storage.ObjectInfo{}, objects...))
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("select failed: %v", err)
+			}
+			var actual []string
+			for _, obj := range selected {
+				actual = append(actual, obj.Name)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				tt.Fatalf("wrong objects: expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCommandWithLimitModeTruncateShouldDownloadFirstObjects(t *testing.T) {
+	var objects []storage.ObjectInfo
+	for i := 0; i < 10; i++ {
+		objects = append(objects, storage.ObjectInfo{Name: fmt.Sprintf("prefix/%02d", i), Size: 100})
+	}
+
+	for _, listShards := range []string{"1", "4"} {
+		t.Run("list shards "+listShards, func(tt *testing.T) {
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					return objects
+				},
+				ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+					return []byte(objectName)
+				},
+			}
+
+			mutex := sync.Mutex{}
+			var copied []string
+			fileCopier = &file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					copied = append(copied, path)
+					return 0, nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path", "--max-objects", "5", "--max-bytes", "350", "--limit-mode", "truncate", "--list-shards", listShards})
+			if err := command.Execute(); err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+
+			sort.Strings(copied)
+			expected := []string{"path/00", "path/01", "path/02"}
+			if !reflect.DeepEqual(copied, expected) {
+				tt.Fatalf("wrong objects copied: expected %v, got %v", expected, copied)
+			}
+		})
+	}
+}
+
+func TestConfigureLimitModeValidation(t *testing.T) {
+	r := runner{limitMode: "bogus"}
+	err := r.configure(NewCommand(), []string{"bucket", "prefix", "path"})
+	if err == nil || !strings.Contains(err.Error(), "--limit-mode") {
+		t.Fatalf("expected --limit-mode error, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// mirrorOutputDirectories deletes files beneath the output directories that do not correspond to any of the listed
+// objects, so that the output directories are an exact replica of the objects. Files that the filters would have
+// excluded from the listing are left alone, as are the index file and directories that archives were extracted to.
+func (r *runner) mirrorOutputDirectories(objects []*storage.ObjectInfo) error {
+	keep := map[string]bool{}
+	keepDirectories := map[string]bool{}
+	for _, obj := range objects {
+		p := filepath.Clean(r.getPathForObject(obj.Name))
+		keep[p] = true
+		if dirPath := extractDirectory(p); r.extract && dirPath != "" {
+			keepDirectories[dirPath] = true
+		}
+	}
+	if r.indexFile != "" {
+		keep[filepath.Clean(r.indexFile)] = true
+	}
+
+	var extraneous []string
+	for _, dir := range r.outputDirectories {
+		dir = filepath.Clean(dir)
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				// Nothing has been downloaded to this directory, such as in a dry run
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if keepDirectories[p] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !keep[p] && r.isInMirrorScope(dir, p) {
+				extraneous = append(extraneous, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list files in %s: %v", dir, err)
+		}
+	}
+
+	if r.maxDelete > 0 && len(extraneous) > r.maxDelete {
+		return fmt.Errorf("refusing to delete %d files that do not correspond to any object, which is more than --max-delete %d", len(extraneous), r.maxDelete)
+	}
+
+	for _, p := range extraneous {
+		if r.dryRun {
+			r.logf("%s (delete)\n", p)
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", p, err)
+		}
+		r.logf("%s (deleted)\n", p)
+		removeEmptyDirectories(filepath.Dir(p), r.outputDirectories)
+	}
+	return nil
+}
+
+// isInMirrorScope returns true if a file beneath an output directory is where an object would be saved that matches
+// --start-after, --end-before and --max-depth
+func (r *runner) isInMirrorScope(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if r.maxDepth > 0 && strings.Count(rel, "/")+1 > r.maxDepth {
+		return false
+	}
+	name := strings.TrimPrefix(path.Join(r.prefix, rel), "/")
+	if r.startAfter != "" && name <= r.startAfter {
+		return false
+	}
+	if r.endBefore != "" && name >= r.endBefore {
+		return false
+	}
+	return true
+}
+
+// removeEmptyDirectories removes a directory and then each of its parents, for as long as they are empty, stopping at
+// the output directories
+func removeEmptyDirectories(dir string, outputDirectories []string) {
+	for {
+		for _, outputDirectory := range outputDirectories {
+			if filepath.Clean(outputDirectory) == dir {
+				return
+			}
+		}
+		if os.Remove(dir) != nil {
+			// The directory is not empty
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func listFilesForTest(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if d.IsDir() {
+			rel += "/"
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestCommandShouldMirrorOutputDirectory(t *testing.T) {
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{
+				{Name: "prefix/a"},
+				{Name: "prefix/sub/d"},
+			}
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+	fileCopier = file.NewOsCopier()
+
+	testCases := map[string]struct {
+		args          []string
+		expectedFiles []string
+		expectedError string
+	}{
+		"mirror": {
+			expectedFiles: []string{"./", "a", "sub/", "sub/d", "zzz/", "zzz/out-of-scope"},
+		},
+		"dry run": {
+			args:          []string{"--dry-run"},
+			expectedFiles: []string{"./", "a", "stale", "stale-dir/", "stale-dir/nested/", "stale-dir/nested/c", "zzz/", "zzz/out-of-scope"},
+		},
+		"max delete": {
+			args:          []string{"--max-delete", "1"},
+			expectedError: "more than --max-delete 1",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			dir := writeUploadTestFiles(tt, map[string]string{
+				"a":                  "old content",
+				"stale":              "stale",
+				"stale-dir/nested/c": "stale",
+				"zzz/out-of-scope":   "not listed because of --end-before",
+			})
+
+			command := NewCommand()
+			command.SetArgs(append([]string{"bucket", "prefix", dir, "--mirror", "--end-before", "prefix/zzz"}, tc.args...))
+			err := command.Execute()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+
+			files := listFilesForTest(tt, dir)
+			if strings.Join(files, ",") != strings.Join(tc.expectedFiles, ",") {
+				tt.Fatalf("wrong files: expected %q, got %q", tc.expectedFiles, files)
+			}
+		})
+	}
+}
+
+func TestConfigureMirrorValidation(t *testing.T) {
+	testCases := map[string]*runner{
+		"with archive":        {mirror: true, archive: "tar"},
+		"with sample":         {mirror: true, sampleCount: 10},
+		"with newest":         {mirror: true, newest: 10},
+		"with shards":         {mirror: true, shardCount: 2},
+		"with truncate":       {mirror: true, limitMode: limitModeTruncate},
+		"negative max delete": {mirror: true, maxDelete: -1},
+	}
+	for name, r := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			if err := r.configure(NewCommand(), []string{"bucket", "prefix", "path"}); err == nil {
+				tt.Fatalf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// isVerifiable returns false if an object's copy can't be compared with its checksum, because it is stored with a
+// content encoding, such as gzip, and downloaded decoded
+func (r *runner) isVerifiable(obj *storage.ObjectInfo) bool {
+	return r.destinationBucket != "" || obj.ContentEncoding == ""
+}
+
+// verifyLocalCopy returns an error unless the file that an object was downloaded to has the object's checksum
+func (r *runner) verifyLocalCopy(obj *storage.ObjectInfo) error {
+	if r.destinationBucket != "" {
+		// copyObjectToBucket has already compared the checksum of the copy
+		return nil
+	}
+	checksummer, ok := r.copier.(file.Checksummer)
+	if !ok {
+		return fmt.Errorf("cannot verify the local copy of %s, so it was not deleted", obj.Name)
+	}
+
+	path := r.getPathForObject(obj.Name)
+	crc32c, err := checksummer.FileCRC32C(path)
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %v", path, err)
+	}
+	if crc32c != obj.CRC32C {
+		return fmt.Errorf("checksum mismatch for %s: expected crc32c %08x, got %08x, so it was not deleted", path, obj.CRC32C, crc32c)
+	}
+	return nil
+}
+
+// deleteDownloadedObject deletes an object that has been downloaded, unless it has since been replaced by a newer
+// generation
+func (r *runner) deleteDownloadedObject(ctx context.Context, obj *storage.ObjectInfo) error {
+	if obj.Generation == 0 {
+		// Deleting without a generation precondition could delete a newer generation
+		return fmt.Errorf("cannot delete %s because its generation is unknown", obj.Name)
+	}
+
+	err := storageClient.DeleteObject(ctx, r.bucketName, obj.Name, storage.Conditions{GenerationMatch: obj.Generation})
+	switch {
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s was not deleted because it was replaced after it was downloaded\n", obj.Name)
+		return nil
+	case errors.Is(err, storage.ErrObjectNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to delete %s: %v", obj.Name, err)
+	}
+
+	if r.verbose {
+		r.logf("deleted %s%s/%s\n", bucketURLScheme, r.bucketName, obj.Name)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestCommandShouldDeleteObjectsAfterDownload(t *testing.T) {
+	testCases := map[string]struct {
+		objects         []storage.ObjectInfo
+		deleteErr       error
+		expectedDeletes []string
+		expectedError   string
+	}{
+		"verified": {
+			objects:         []storage.ObjectInfo{{Name: "prefix/a", Generation: 1}, {Name: "prefix/b", Generation: 2}},
+			expectedDeletes: []string{"prefix/a@1", "prefix/b@2"},
+		},
+		"checksum mismatch": {
+			objects:       []storage.ObjectInfo{{Name: "prefix/a", Generation: 1, CRC32C: 1}},
+			expectedError: "checksum mismatch",
+		},
+		"content encoding": {
+			// The stored checksum is of the compressed data, but the object is downloaded decompressed
+			objects:         []storage.ObjectInfo{{Name: "prefix/a", Generation: 1}, {Name: "prefix/b", Generation: 2, ContentEncoding: "gzip", CRC32C: 1}},
+			expectedDeletes: []string{"prefix/a@1"},
+		},
+		"replaced": {
+			objects:         []storage.ObjectInfo{{Name: "prefix/a", Generation: 1}},
+			deleteErr:       storage.ErrPreconditionFailed,
+			expectedDeletes: []string{"prefix/a@1"},
+		},
+		"unknown generation": {
+			objects:       []storage.ObjectInfo{{Name: "prefix/a"}},
+			expectedError: "generation is unknown",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var mutex sync.Mutex
+			var deletes []string
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					objects := append([]storage.ObjectInfo{}, tc.objects...)
+					for i := range objects {
+						if objects[i].CRC32C == 0 {
+							objects[i].CRC32C = crc32cForTest([]byte(objects[i].Name))
+						}
+					}
+					return objects
+				},
+				ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+					return []byte(objectName)
+				},
+				DeleteObjectFunc: func(bucketName, objectName string, conditions storage.Conditions) error {
+					mutex.Lock()
+					defer mutex.Unlock()
+					deletes = append(deletes, fmt.Sprintf("%s@%d", objectName, conditions.GenerationMatch))
+					return tc.deleteErr
+				},
+			}
+			files := map[string][]byte{}
+			fileCopier = &file.MockChecksumCopier{
+				MockCopier: file.MockCopier{
+					CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+						content, err := io.ReadAll(reader)
+						mutex.Lock()
+						defer mutex.Unlock()
+						files[path] = content
+						return int64(len(content)), err
+					},
+				},
+				FileCRC32CImplementation: func(path string) (uint32, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return crc32cForTest(files[path]), nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path", "--delete-after-download"})
+			err := command.Execute()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				if len(deletes) > 0 {
+					tt.Fatalf("expected no deletes, got %v", deletes)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			sort.Strings(deletes)
+			if strings.Join(deletes, ",") != strings.Join(tc.expectedDeletes, ",") {
+				tt.Fatalf("wrong deletes: expected %q, got %q", tc.expectedDeletes, deletes)
+			}
+		})
+	}
+}
+
+// replacedObjectClient is a client holding a newer generation of every object than the one that was listed
+type replacedObjectClient struct {
+	storage.MockClient
+	currentGeneration int64
+}
+
+func (c *replacedObjectClient) ReadObjectRange(ctx context.Context, bucketName, objectName string, generation, offset, length int64) (io.ReadCloser, error) {
+	if generation != c.currentGeneration {
+		return nil, storage.ErrObjectNotExist
+	}
+	return c.MockClient.ReadObjectRange(ctx, bucketName, objectName, generation, offset, length)
+}
+
+func TestCommandShouldSkipObjectReplacedBeforeDownload(t *testing.T) {
+	storageClient = &replacedObjectClient{
+		currentGeneration: 2,
+		MockClient: storage.MockClient{
+			ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+				return []storage.ObjectInfo{{Name: "prefix/a", Generation: 1}}
+			},
+			ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+				return []byte("newer content")
+			},
+			DeleteObjectFunc: func(bucketName, objectName string, conditions storage.Conditions) error {
+				t.Errorf("unexpected delete of %s", objectName)
+				return nil
+			},
+		},
+	}
+	fileCopier = &file.MockChecksumCopier{
+		MockCopier: file.MockCopier{
+			CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+				t.Errorf("unexpected copy to %s", path)
+				return 0, nil
+			},
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "path", "--delete-after-download"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+}
+
+func TestConfigureDeleteAfterDownloadValidation(t *testing.T) {
+	testCases := map[string]*runner{
+		"with archive":    {deleteAfterDownload: true, archive: "tar"},
+		"with decompress": {deleteAfterDownload: true, decompress: decompressAuto},
+	}
+	for name, r := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			if err := r.configure(NewCommand(), []string{"bucket", "prefix", "path"}); err == nil {
+				tt.Fatalf("expected error")
+			}
+		})
+	}
+}
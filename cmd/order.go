@@ -0,0 +1,47 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"sort"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+const (
+	orderName           = "name"
+	orderSizeAscending  = "size-asc"
+	orderSizeDescending = "size-desc"
+	orderUpdated        = "updated"
+)
+
+// sortObjects sorts objects in place into the order in which they should be downloaded.
+// Objects that compare equal remain in name order.
+func sortObjects(objects []*storage.ObjectInfo, order string) {
+	var less func(a, b *storage.ObjectInfo) bool
+	switch order {
+	case orderSizeAscending:
+		less = func(a, b *storage.ObjectInfo) bool { return a.Size < b.Size }
+	case orderSizeDescending:
+		less = func(a, b *storage.ObjectInfo) bool { return a.Size > b.Size }
+	case orderUpdated:
+		less = func(a, b *storage.ObjectInfo) bool { return a.Updated.Before(b.Updated) }
+	default:
+		return
+	}
+	sort.SliceStable(objects, func(i, j int) bool { return less(objects[i], objects[j]) })
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestSortObjects(t *testing.T) {
+	now := time.Now()
+	objects := []*storage.ObjectInfo{
+		{Name: "a", Size: 2, Updated: now.Add(2 * time.Minute)},
+		{Name: "b", Size: 3, Updated: now},
+		{Name: "c", Size: 1, Updated: now.Add(time.Minute)},
+		{Name: "d", Size: 2, Updated: now.Add(3 * time.Minute)},
+	}
+	testCases := map[string][]string{
+		orderName:           {"a", "b", "c", "d"},
+		orderSizeAscending:  {"c", "a", "d", "b"},
+		orderSizeDescending: {"b", "a", "d", "c"},
+		orderUpdated:        {"b", "c", "a", "d"},
+	}
+	for order, expected := range testCases {
+		t.Run(order, func(tt *testing.T) {
+			sorted := append([]*storage.ObjectInfo{}, objects...)
+			sortObjects(sorted, order)
+			var actual []string
+			for _, obj := range sorted {
+				actual = append(actual, obj.Name)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				tt.Fatalf("wrong order: expected %v, got %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestCommandShouldLimitLargeObjectConcurrencySeparately(t *testing.T) {
+	var objects []storage.ObjectInfo
+	for i := 0; i < 10; i++ {
+		objects = append(objects, storage.ObjectInfo{Name: fmt.Sprintf("prefix/small-%d", i), Size: 10})
+		objects = append(objects, storage.ObjectInfo{Name: fmt.Sprintf("prefix/large-%d", i), Size: 1000})
+	}
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return objects
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	mutex := sync.Mutex{}
+	active := map[bool]int{}
+	maxActive := map[bool]int{}
+	copied := 0
+	fileCopier = &file.MockCopier{
+		CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+			b, _ := io.ReadAll(reader)
+			large := strings.Contains(string(b), "large")
+			mutex.Lock()
+			active[large]++
+			if active[large] > maxActive[large] {
+				maxActive[large] = active[large]
+			}
+			mutex.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mutex.Lock()
+			active[large]--
+			copied++
+			mutex.Unlock()
+			return int64(len(b)), nil
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "path", "--large-object-threshold", "1KB", "--max-concurrent-large", "1", "--max-concurrent", "4", "--order", "size-desc"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+
+	if copied != len(objects) {
+		t.Fatalf("wrong file count: expected %d, got %d", len(objects), copied)
+	}
+	if maxActive[true] != 1 {
+		t.Fatalf("wrong large object concurrency: expected 1, got %d", maxActive[true])
+	}
+	if maxActive[false] > 4 {
+		t.Fatalf("wrong small object concurrency: expected at most 4, got %d", maxActive[false])
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket that limits the aggregate rate at which bytes are read by all readers that share it
+type Limiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a new Limiter that allows bytesPerSecond on average, with bursts of up to burst bytes
+func NewLimiter(bytesPerSecond, burst int64) *Limiter {
+	if burst <= 0 {
+		burst = bytesPerSecond
+	}
+	return &Limiter{
+		rate:   float64(bytesPerSecond),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes may be consumed without exceeding the rate limit.
+// Tokens are reserved before waiting, so concurrent callers are served in the order they call WaitN.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reader wraps a reader so that reading from it consumes tokens from the limiter
+func (l *Limiter) Reader(ctx context.Context, reader io.ReadCloser) io.ReadCloser {
+	return &limitedReader{ctx: ctx, limiter: l, reader: reader}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	limiter *Limiter
+	reader  io.ReadCloser
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// Read no more than the burst size at a time, so that large buffers don't cause long pauses
+	if len(p) > int(r.limiter.burst) {
+		p = p[:int(r.limiter.burst)]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *limitedReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterShouldLimitAggregateRate(t *testing.T) {
+	const rate = 100 * 1024
+	limiter := NewLimiter(rate, 10*1024)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader := limiter.Reader(context.Background(), io.NopCloser(bytes.NewReader(make([]byte, 10*1024))))
+			_, _ = io.Copy(io.Discard, reader)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// 40KiB at 100KiB/s with a 10KiB burst should take about 300ms
+	if elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("wrong elapsed time: got %v", elapsed)
+	}
+}
+
+func TestLimiterShouldStopWaitingWhenContextIsCancelled(t *testing.T) {
+	limiter := NewLimiter(1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.WaitN(ctx, 1000); err == nil {
+		t.Fatalf("expected error")
+	}
+}
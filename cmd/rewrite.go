@@ -0,0 +1,66 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+const bucketURLScheme = "gs://"
+
+// isBucketURL returns true if a destination is a bucket URL, such as gs://bucket/prefix, instead of a local path
+func isBucketURL(destination string) bool {
+	return strings.HasPrefix(destination, bucketURLScheme)
+}
+
+// parseBucketURL splits a bucket URL into the bucket name and the prefix of the objects within it
+func parseBucketURL(url string) (string, string, error) {
+	bucketName, prefix, _ := strings.Cut(strings.TrimPrefix(url, bucketURLScheme), "/")
+	if bucketName == "" {
+		return "", "", fmt.Errorf("invalid destination %s: the bucket name is missing", url)
+	}
+	return bucketName, prefix, nil
+}
+
+// getDestinationObjectName returns the name of the object that an object is copied to in the destination bucket. The
+// rest of the name is kept exactly as it is, since cleaning it like a path could change which object it refers to.
+func (r *runner) getDestinationObjectName(name string) string {
+	return r.destinationPrefix + strings.TrimPrefix(name, r.prefix)
+}
+
+// copyObjectToBucket copies an object to the destination bucket with server-side rewrites, so that its content does
+// not pass through this host
+func (r *runner) copyObjectToBucket(ctx context.Context, obj *storage.ObjectInfo) error {
+	start := time.Now()
+	dstObjectName := r.getDestinationObjectName(obj.Name)
+	copied, err := storageClient.CopyObject(ctx, r.bucketName, obj.Name, obj.Generation, r.destinationBucket, dstObjectName)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s%s/%s: %w", obj.Name, bucketURLScheme, r.destinationBucket, dstObjectName, err)
+	}
+	if copied.CRC32C != obj.CRC32C {
+		return fmt.Errorf("checksum mismatch for %s: expected crc32c %08x, got %08x", obj.Name, obj.CRC32C, copied.CRC32C)
+	}
+	r.throughput.record(copied.Size, time.Since(start))
+
+	r.printObject(obj.Name, copied.Size)
+	return nil
+}
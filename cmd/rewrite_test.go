@@ -0,0 +1,170 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestCommandShouldCopyObjectsToBucket(t *testing.T) {
+	testCases := map[string]struct {
+		destination    string
+		expectedCopies []string
+	}{
+		"bucket with prefix": {
+			destination:    "gs://other/copied/",
+			expectedCopies: []string{"bucket/prefix/a@1->other/copied/a", "bucket/prefix/dir/b@2->other/copied/dir/b"},
+		},
+		"bucket root": {
+			destination:    "gs://other",
+			expectedCopies: []string{"bucket/prefix/a@1->other/a", "bucket/prefix/dir/b@2->other/dir/b"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var mutex sync.Mutex
+			var copies []string
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					return []storage.ObjectInfo{
+						{Name: "prefix/a", Size: 1, Generation: 1, CRC32C: 0x1111},
+						{Name: "prefix/dir/b", Size: 2, Generation: 2, CRC32C: 0x2222},
+					}
+				},
+				ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+					tt.Errorf("unexpected read of %s", objectName)
+					return nil
+				},
+				CopyObjectFunc: func(srcBucketName, srcObjectName string, srcGeneration int64, dstBucketName, dstObjectName string) (storage.ObjectInfo, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					copies = append(copies, srcBucketName+"/"+srcObjectName+"@"+strconv.FormatInt(srcGeneration, 10)+"->"+dstBucketName+"/"+dstObjectName)
+					crc32c := uint32(0x1111)
+					if strings.HasSuffix(srcObjectName, "b") {
+						crc32c = 0x2222
+					}
+					return storage.ObjectInfo{Name: dstObjectName, CRC32C: crc32c}, nil
+				},
+			}
+			fileCopier = &file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					tt.Errorf("unexpected write to %s", path)
+					return 0, nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix/", tc.destination})
+			if err := command.Execute(); err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			sort.Strings(copies)
+			if strings.Join(copies, ",") != strings.Join(tc.expectedCopies, ",") {
+				tt.Fatalf("wrong copies: expected %q, got %q", tc.expectedCopies, copies)
+			}
+		})
+	}
+}
+
+func TestCommandShouldFailCopyWithChecksumMismatch(t *testing.T) {
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return []storage.ObjectInfo{{Name: "prefix/a", Size: 1, Generation: 1, CRC32C: 0x1111}}
+		},
+		CopyObjectFunc: func(srcBucketName, srcObjectName string, srcGeneration int64, dstBucketName, dstObjectName string) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{Name: dstObjectName, CRC32C: 0x2222}, nil
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix/", "gs://other"})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestConfigureBucketDestinationValidation(t *testing.T) {
+	testCases := map[string]struct {
+		r    *runner
+		args []string
+	}{
+		"missing bucket":      {r: &runner{}, args: []string{"bucket", "prefix", "gs://"}},
+		"same as source":      {r: &runner{}, args: []string{"bucket", "prefix", "gs://bucket/prefix"}},
+		"trailing slash":      {r: &runner{}, args: []string{"bucket", "prefix", "gs://bucket/prefix/"}},
+		"leading slash":       {r: &runner{}, args: []string{"bucket", "/prefix/", "gs://bucket/prefix"}},
+		"nested in source":    {r: &runner{}, args: []string{"bucket", "prefix", "gs://bucket/prefix/copy"}},
+		"source nested":       {r: &runner{}, args: []string{"bucket", "prefix/sub", "gs://bucket/prefix"}},
+		"bucket root":         {r: &runner{}, args: []string{"bucket", "prefix", "gs://bucket"}},
+		"multiple":            {r: &runner{}, args: []string{"bucket", "prefix", "gs://other", "gs://another"}},
+		"with archive":        {r: &runner{archive: "tar"}, args: []string{"bucket", "prefix", "gs://other"}},
+		"with extract":        {r: &runner{extract: true}, args: []string{"bucket", "prefix", "gs://other"}},
+		"with decompress":     {r: &runner{decompress: decompressAuto}, args: []string{"bucket", "prefix", "gs://other"}},
+		"with min free space": {r: &runner{minFreeSpace: 1}, args: []string{"bucket", "prefix", "gs://other"}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			if err := tc.r.configure(NewCommand(), tc.args); err == nil {
+				tt.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestConfigureBucketDestinationAllowsSiblingPrefix(t *testing.T) {
+	r := &runner{}
+	if err := r.configure(NewCommand(), []string{"bucket", "prefix", "gs://bucket/prefix-copy"}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+	if r.destinationPrefix != "prefix-copy/" {
+		t.Fatalf("wrong destination prefix: %q", r.destinationPrefix)
+	}
+}
+
+func TestGetDestinationObjectName(t *testing.T) {
+	testCases := map[string]string{
+		"src/a":        "dst/a",
+		"src/a//b":     "dst/a//b",
+		"src/./c":      "dst/./c",
+		"src/../../e":  "dst/../../e",
+		"src/../src/d": "dst/../src/d",
+	}
+	r := &runner{}
+	if err := r.configure(NewCommand(), []string{"bucket", "src", "gs://bucket/dst"}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+	for name, expected := range testCases {
+		if actual := r.getDestinationObjectName(name); actual != expected {
+			t.Errorf("wrong destination for %s: expected %s, got %s", name, expected, actual)
+		}
+	}
+
+	r = &runner{}
+	if err := r.configure(NewCommand(), []string{"bucket", "src", "gs://other"}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+	if actual := r.getDestinationObjectName("src/a//b"); actual != "a//b" {
+		t.Errorf("wrong destination at bucket root: expected a//b, got %s", actual)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// sampler selects a reproducible random subset of objects as they are listed.
+// Each object is assigned a pseudo-random value by hashing its name with the seed, so the same objects are selected
+// for the same seed regardless of the order in which they are listed.
+type sampler struct {
+	seed      int64
+	percent   float64
+	count     int
+	reservoir sampleHeap
+}
+
+type sample struct {
+	value uint64
+	obj   *storage.ObjectInfo
+}
+
+// keep returns true if an object should be kept when sampling a percentage of objects.
+// When sampling a fixed number of objects, the object is instead added to the reservoir and false is returned.
+func (s *sampler) keep(obj *storage.ObjectInfo) bool {
+	value := s.value(obj.Name)
+	if s.count > 0 {
+		// Keep the objects with the lowest values, which is a uniform random sample of the objects seen so far
+		if s.reservoir.Len() < s.count {
+			heap.Push(&s.reservoir, sample{value: value, obj: obj})
+		} else if value < s.reservoir[0].value {
+			s.reservoir[0] = sample{value: value, obj: obj}
+			heap.Fix(&s.reservoir, 0)
+		}
+		return false
+	}
+	if s.percent >= 100 {
+		return true
+	}
+	return float64(value) < s.percent/100*math.MaxUint64
+}
+
+// sampled returns the objects in the reservoir
+func (s *sampler) sampled() []*storage.ObjectInfo {
+	var objects []*storage.ObjectInfo
+	for _, entry := range s.reservoir {
+		objects = append(objects, entry.obj)
+	}
+	return objects
+}
+
+func (s *sampler) value(name string) uint64 {
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, s.seed)
+	_, _ = h.Write([]byte(name))
+
+	// FNV does not mix its final bytes well, so finish with the splitmix64 finalizer
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// sampleHeap is a max-heap of samples, so the sample with the highest value can be replaced
+type sampleHeap []sample
+
+func (h sampleHeap) Len() int { return len(h) }
+
+func (h sampleHeap) Less(i, j int) bool {
+	if h[i].value != h[j].value {
+		return h[i].value > h[j].value
+	}
+	return h[i].obj.Name > h[j].obj.Name
+}
+
+func (h sampleHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *sampleHeap) Push(x interface{}) { *h = append(*h, x.(sample)) }
+
+func (h *sampleHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func sampleNames(s *sampler, objects []*storage.ObjectInfo) []string {
+	var names []string
+	for _, obj := range objects {
+		if s.keep(obj) {
+			names = append(names, obj.Name)
+		}
+	}
+	for _, obj := range s.sampled() {
+		names = append(names, obj.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSamplerShouldBeReproducible(t *testing.T) {
+	var objects []*storage.ObjectInfo
+	for i := 0; i < 10000; i++ {
+		objects = append(objects, &storage.ObjectInfo{Name: fmt.Sprintf("prefix/%05d", i)})
+	}
+	reversed := make([]*storage.ObjectInfo, len(objects))
+	for i, obj := range objects {
+		reversed[len(objects)-1-i] = obj
+	}
+
+	t.Run("percent", func(tt *testing.T) {
+		sampled := sampleNames(&sampler{seed: 1, percent: 10}, objects)
+		if len(sampled) < 900 || len(sampled) > 1100 {
+			tt.Fatalf("expected about 1000 objects, got %d", len(sampled))
+		}
+		if again := sampleNames(&sampler{seed: 1, percent: 10}, reversed); !reflect.DeepEqual(sampled, again) {
+			tt.Fatalf("the same seed should select the same objects")
+		}
+		if other := sampleNames(&sampler{seed: 2, percent: 10}, objects); reflect.DeepEqual(sampled, other) {
+			tt.Fatalf("a different seed should select different objects")
+		}
+	})
+
+	t.Run("count", func(tt *testing.T) {
+		sampled := sampleNames(&sampler{seed: 1, count: 200}, objects)
+		if len(sampled) != 200 {
+			tt.Fatalf("expected 200 objects, got %d", len(sampled))
+		}
+		if again := sampleNames(&sampler{seed: 1, count: 200}, reversed); !reflect.DeepEqual(sampled, again) {
+			tt.Fatalf("the same seed should select the same objects")
+		}
+		if other := sampleNames(&sampler{seed: 2, count: 200}, objects); reflect.DeepEqual(sampled, other) {
+			tt.Fatalf("a different seed should select different objects")
+		}
+	})
+}
+
+func TestCommandWithSampleCountShouldDownloadSample(t *testing.T) {
+	var objects []storage.ObjectInfo
+	for i := 0; i < 100; i++ {
+		objects = append(objects, storage.ObjectInfo{Name: fmt.Sprintf("prefix/%02d", i)})
+	}
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return objects
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	var runs [][]string
+	for _, listShards := range []string{"1", "8"} {
+		mutex := sync.Mutex{}
+		var copied []string
+		fileCopier = &file.MockCopier{
+			CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				copied = append(copied, path)
+				return 0, nil
+			},
+		}
+
+		command := NewCommand()
+		command.SetArgs([]string{"bucket", "prefix", "path", "--sample-count", "10", "--seed", "42", "--list-shards", listShards})
+		if err := command.Execute(); err != nil {
+			t.Fatalf("execute failed: %v", err)
+		}
+		if len(copied) != 10 {
+			t.Fatalf("expected 10 objects to be copied, got %d", len(copied))
+		}
+		sort.Strings(copied)
+		runs = append(runs, copied)
+	}
+
+	if !reflect.DeepEqual(runs[0], runs[1]) {
+		t.Fatalf("the same seed should select the same objects: %v, %v", runs[0], runs[1])
+	}
+}
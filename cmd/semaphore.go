@@ -0,0 +1,67 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"sync"
+)
+
+// semaphore limits the number of concurrent operations, using a limit that can be changed while it is in use
+type semaphore struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+// newSemaphore creates a new semaphore that allows up to limit concurrent operations (0=unlimited)
+func newSemaphore(limit int) *semaphore {
+	s := &semaphore{limit: limit}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+func (s *semaphore) acquire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for s.limit > 0 && s.active >= s.limit {
+		s.cond.Wait()
+	}
+	s.active++
+}
+
+func (s *semaphore) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.active--
+	s.cond.Broadcast()
+}
+
+func (s *semaphore) getLimit() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.limit
+}
+
+// setLimit changes the limit, which applies to subsequent calls to acquire.
+// Operations that have already acquired the semaphore are not affected if the limit is reduced.
+func (s *semaphore) setLimit(limit int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.limit = limit
+	s.cond.Broadcast()
+}
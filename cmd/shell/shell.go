@@ -0,0 +1,33 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package shell runs user-supplied command lines using the platform's shell
+package shell
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// Command returns a command that runs a command line using the shell, with additional environment variables.
+// The command is killed if the context is done before it exits.
+func Command(ctx context.Context, commandLine string, env ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, shellPath, append(shellArgs, commandLine)...)
+	cmd.Env = append(os.Environ(), env...)
+	setCommandLine(cmd, commandLine)
+	return cmd
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shell
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands use a POSIX shell")
+	}
+
+	for _, value := range []string{"foo", "foo bar", "it's", `"$(echo injected)"`, "a\\b", ""} {
+		quoted, err := Quote(value)
+		if err != nil {
+			t.Fatalf("quote failed for %q: %v", value, err)
+		}
+		output, err := Command(context.Background(), "printf %s "+quoted).Output()
+		if err != nil {
+			t.Fatalf("command failed for %q: %v", value, err)
+		}
+		if string(output) != value {
+			t.Fatalf("wrong output: expected %q, got %q", value, output)
+		}
+	}
+}
+
+func TestCommandEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands use a POSIX shell")
+	}
+
+	output, err := Command(context.Background(), `echo "$FOO"`, "FOO=bar").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(output)) != "bar" {
+		t.Fatalf("wrong output: expected %q, got %q", "bar", output)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shell
+
+import (
+	"os/exec"
+	"strings"
+)
+
+var (
+	shellPath = "/bin/sh"
+	shellArgs = []string{"-c"}
+)
+
+// Quote quotes a value so that the shell treats it as a single literal word
+func Quote(value string) (string, error) {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'", nil
+}
+
+// setCommandLine does nothing, since the command line is passed to the shell as a single argument
+func setCommandLine(_ *exec.Cmd, _ string) {}
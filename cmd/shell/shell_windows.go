@@ -0,0 +1,49 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shell
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+var (
+	shellPath = "cmd.exe"
+	shellArgs = []string{"/C"}
+)
+
+// Quote quotes a value so that cmd.exe treats it as a single literal word. cmd.exe has no way to escape a quote within
+// quotes, and expands environment variables such as %PATH% even within quotes, so values that contain either
+// character are rejected.
+func Quote(value string) (string, error) {
+	if strings.ContainsAny(value, `"%`) {
+		return "", fmt.Errorf("%s cannot be quoted for cmd.exe, because it contains \" or %%", value)
+	}
+	return `"` + value + `"`, nil
+}
+
+// setCommandLine passes the command line to cmd.exe exactly as it is. Otherwise, it would be escaped for programs
+// that parse their arguments like the C runtime, with a backslash before each quote, which cmd.exe doesn't understand.
+// With /S, cmd.exe removes the outer quotes and runs everything between them unchanged.
+func setCommandLine(cmd *exec.Cmd, commandLine string) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: fmt.Sprintf(`%s /S /C "%s"`, shellPath, commandLine)}
+}
@@ -0,0 +1,59 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shell
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestQuoteWindows(t *testing.T) {
+	for _, value := range []string{"foo", "foo bar", "it's", "a & b | c > d", `C:\dir\file.txt`, ""} {
+		quoted, err := Quote(value)
+		if err != nil {
+			t.Fatalf("quote failed for %q: %v", value, err)
+		}
+		// echo prints its arguments as they are, including the quotes
+		output, err := Command(context.Background(), "echo "+quoted).Output()
+		if err != nil {
+			t.Fatalf("command failed for %q: %v", value, err)
+		}
+		if strings.TrimRight(string(output), "\r\n") != quoted {
+			t.Fatalf("wrong output: expected %q, got %q", quoted, output)
+		}
+	}
+
+	for _, value := range []string{`say "hi"`, "100%", "%PATH%"} {
+		if _, err := Quote(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestCommandPassesQuotesToCmdExe(t *testing.T) {
+	output, err := Command(context.Background(), `echo "quoted" & echo %FOO%`, "FOO=bar").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\"quoted\" \r\nbar\r\n"; string(output) != expected {
+		t.Fatalf("wrong output: expected %q, got %q", expected, output)
+	}
+}
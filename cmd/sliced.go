@@ -0,0 +1,109 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/brianpursley/gsdownload/cmd/checksum"
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+type sliceResult struct {
+	index  int
+	crc32c uint32
+	err    error
+}
+
+// isSliced returns true if an object is large enough to be downloaded in slices. Objects with a content encoding are
+// never sliced, since the whole decoded content is sent for any range.
+func (r *runner) isSliced(obj *storage.ObjectInfo) bool {
+	return r.slicedThreshold > 0 && r.slices > 1 && obj.Size >= int64(r.slicedThreshold) && obj.ContentEncoding == ""
+}
+
+// downloadObjectSliced downloads ranges of an object concurrently into a preallocated file, and then verifies the
+// checksum of the whole object by combining the checksums of each slice
+func (r *runner) downloadObjectSliced(ctx context.Context, obj *storage.ObjectInfo, copier file.SlicedCopier) error {
+	path := r.getPathForObject(obj.Name)
+	if err := copier.AllocateFile(path, obj.Size); err != nil {
+		return fmt.Errorf("failed writing to file %s: %v", obj.Name, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sliceSize := (obj.Size + int64(r.slices) - 1) / int64(r.slices)
+	sliceCount := int((obj.Size + sliceSize - 1) / sliceSize)
+	resultChan := make(chan sliceResult, sliceCount)
+	for i := 0; i < sliceCount; i++ {
+		go func(index int) {
+			offset := int64(index) * sliceSize
+			length := sliceSize
+			if offset+length > obj.Size {
+				length = obj.Size - offset
+			}
+			crc32c, err := r.downloadSlice(ctx, obj, copier, path, offset, length)
+			resultChan <- sliceResult{index: index, crc32c: crc32c, err: err}
+		}(i)
+	}
+
+	checksums := make([]uint32, sliceCount)
+	for i := 0; i < sliceCount; i++ {
+		result := <-resultChan
+		if result.err != nil {
+			return result.err
+		}
+		checksums[result.index] = result.crc32c
+	}
+
+	crc32c := checksums[0]
+	for i := 1; i < sliceCount; i++ {
+		length := sliceSize
+		if i == sliceCount-1 {
+			length = obj.Size - int64(i)*sliceSize
+		}
+		crc32c = checksum.CombineCRC32C(crc32c, checksums[i], length)
+	}
+	if crc32c != obj.CRC32C {
+		return fmt.Errorf("checksum mismatch for %s: expected crc32c %08x, got %08x", obj.Name, obj.CRC32C, crc32c)
+	}
+
+	r.printObject(obj.Name, obj.Size)
+	return nil
+}
+
+func (r *runner) downloadSlice(ctx context.Context, obj *storage.ObjectInfo, copier file.SlicedCopier, path string, offset, length int64) (uint32, error) {
+	reader, err := r.readObjectRange(ctx, obj, offset, length)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create new reader for %s at offset %d: %w", obj.Name, offset, err)
+	}
+	defer reader.Close()
+
+	hash := checksum.NewCRC32C()
+	bytes, err := copier.CopyToFileAt(path, offset, io.TeeReader(reader, hash))
+	if err != nil {
+		return 0, fmt.Errorf("failed writing to file %s at offset %d: %v", obj.Name, offset, err)
+	}
+	if bytes != length {
+		return 0, fmt.Errorf("short read for %s at offset %d: expected %d bytes, got %d", obj.Name, offset, length, bytes)
+	}
+
+	return hash.Sum32(), nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestCommandShouldDownloadLargeObjectsInSlices(t *testing.T) {
+	data := make([]byte, 1001)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	crc32c := crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+
+	testCases := map[string]struct {
+		crc32c          uint32
+		expectSliced    bool
+		expectError     bool
+		slicedThreshold string
+		contentEncoding string
+	}{
+		"below threshold":        {crc32c: crc32c, slicedThreshold: "1KiB", expectSliced: false},
+		"sliced":                 {crc32c: crc32c, slicedThreshold: "1000", expectSliced: true},
+		"sliced checksum failed": {crc32c: crc32c + 1, slicedThreshold: "1000", expectSliced: true, expectError: true},
+		// The whole decoded content is sent for every range, so each slice would get all of it
+		"content encoding": {crc32c: crc32c, slicedThreshold: "1000", contentEncoding: "gzip", expectSliced: false},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			storageClient = &storage.MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+					return []storage.ObjectInfo{{Name: "prefix/foo", Size: int64(len(data)), CRC32C: tc.crc32c, ContentEncoding: tc.contentEncoding}}
+				},
+				ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+					return data
+				},
+			}
+
+			mutex := sync.Mutex{}
+			var content []byte
+			sliced := false
+			fileCopier = &file.MockSlicedCopier{
+				MockCopier: file.MockCopier{
+					CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+						content, _ = io.ReadAll(reader)
+						return int64(len(content)), nil
+					},
+				},
+				AllocateFileImplementation: func(path string, size int64) error {
+					sliced = true
+					content = make([]byte, size)
+					return nil
+				},
+				CopyToFileAtImplementation: func(path string, offset int64, reader io.Reader) (int64, error) {
+					b, _ := io.ReadAll(reader)
+					mutex.Lock()
+					defer mutex.Unlock()
+					copy(content[offset:], b)
+					return int64(len(b)), nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path", "--sliced-threshold", tc.slicedThreshold, "--slices", "3"})
+			err := command.Execute()
+			if tc.expectError {
+				if err == nil {
+					tt.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			if sliced != tc.expectSliced {
+				tt.Fatalf("wrong sliced: expected %v, got %v", tc.expectSliced, sliced)
+			}
+			if !bytes.Equal(content, data) {
+				tt.Fatalf("wrong file contents")
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+)
+
+// PathDelimiter is the delimiter used to treat object names as hierarchical paths
+const PathDelimiter = "/"
+
+// VisitObjectsToDepth calls a function for each object matched by a query that is no more than maxDepth levels below
+// the query's prefix, where objects directly beneath the prefix are at depth 1.
+// Prefixes that are not descended into because they are at the maximum depth are visited as prefix entries.
+// Each level is listed using VisitObjectsParallel with the specified number of shards.
+func VisitObjectsToDepth(ctx context.Context, client Client, bucketName string, query Query, shards, maxDepth int, visit func(objectInfo ObjectInfo) error) error {
+	query.Delimiter = PathDelimiter
+	var subPrefixes []string
+	err := VisitObjectsParallel(ctx, client, bucketName, query, shards, func(objectInfo ObjectInfo) error {
+		if objectInfo.IsPrefix && maxDepth > 1 {
+			subPrefixes = append(subPrefixes, objectInfo.Name)
+			return nil
+		}
+		return visit(objectInfo)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, subPrefix := range subPrefixes {
+		q := query
+		q.Prefix = subPrefix
+		if err := VisitObjectsToDepth(ctx, client, bucketName, q, shards, maxDepth-1, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestVisitObjectsToDepth(t *testing.T) {
+	client := &MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []ObjectInfo {
+			return []ObjectInfo{
+				{Name: "prefix/a"},
+				{Name: "prefix/b/c"},
+				{Name: "prefix/b/d/e"},
+				{Name: "prefix/f/g"},
+			}
+		},
+	}
+
+	testCases := []struct {
+		maxDepth         int
+		expectedObjects  []string
+		expectedPrefixes []string
+	}{
+		{maxDepth: 1, expectedObjects: []string{"prefix/a"}, expectedPrefixes: []string{"prefix/b/", "prefix/f/"}},
+		{maxDepth: 2, expectedObjects: []string{"prefix/a", "prefix/b/c", "prefix/f/g"}, expectedPrefixes: []string{"prefix/b/d/"}},
+		{maxDepth: 3, expectedObjects: []string{"prefix/a", "prefix/b/c", "prefix/b/d/e", "prefix/f/g"}},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("max depth %d", tc.maxDepth), func(tt *testing.T) {
+			var objects, prefixes []string
+			err := VisitObjectsToDepth(context.Background(), client, "bucket", Query{Prefix: "prefix/"}, 2, tc.maxDepth, func(objectInfo ObjectInfo) error {
+				if objectInfo.IsPrefix {
+					prefixes = append(prefixes, objectInfo.Name)
+				} else {
+					objects = append(objects, objectInfo.Name)
+				}
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("visit failed: %v", err)
+			}
+			sort.Strings(objects)
+			sort.Strings(prefixes)
+			if !reflect.DeepEqual(objects, tc.expectedObjects) {
+				tt.Fatalf("wrong objects: expected %v, got %v", tc.expectedObjects, objects)
+			}
+			if !reflect.DeepEqual(prefixes, tc.expectedPrefixes) {
+				tt.Fatalf("wrong prefixes: expected %v, got %v", tc.expectedPrefixes, prefixes)
+			}
+		})
+	}
+}
@@ -18,12 +18,15 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"sync"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -71,15 +74,23 @@ func (c *GoogleClient) getBucketHandle(bucketName string) *storage.BucketHandle
 	return c.buckets[bucketName]
 }
 
-// VisitObjects calls a function for each object found in a bucket where the object starts with a specified prefix
-func (c *GoogleClient) VisitObjects(ctx context.Context, bucketName, prefix string, visit func(objectInfo ObjectInfo) error) error {
+// VisitObjects calls a function for each object found in a bucket that matches a query
+func (c *GoogleClient) VisitObjects(ctx context.Context, bucketName string, q Query, visit func(objectInfo ObjectInfo) error) error {
 	bucket := c.getBucketHandle(bucketName)
-	query := &storage.Query{Prefix: prefix}
-	err := query.SetAttrSelection([]string{"Name", "Size"})
+	query := &storage.Query{
+		Prefix:      q.Prefix,
+		Delimiter:   q.Delimiter,
+		StartOffset: q.StartOffset,
+		EndOffset:   q.EndOffset,
+	}
+	err := query.SetAttrSelection([]string{"Name", "Size", "Generation", "Updated", "CRC32C", "ContentType", "ContentEncoding"})
 	if err != nil {
 		return err
 	}
 	objectIterator := bucket.Objects(ctx, query)
+	if q.PageSize > 0 {
+		objectIterator.PageInfo().MaxSize = q.PageSize
+	}
 	for {
 		objAttrs, err := objectIterator.Next()
 		if err == iterator.Done {
@@ -88,19 +99,154 @@ func (c *GoogleClient) VisitObjects(ctx context.Context, bucketName, prefix stri
 		if err != nil {
 			return err
 		}
-		objectInfo := ObjectInfo{
-			Name: objAttrs.Name,
-			Size: objAttrs.Size,
+		if objAttrs.Prefix != "" {
+			if err := visit(ObjectInfo{Name: objAttrs.Prefix, IsPrefix: true}); err != nil {
+				return err
+			}
+			continue
 		}
-		if err := visit(objectInfo); err != nil {
+		if err := visit(newObjectInfo(objAttrs)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// getObjectHandle returns a handle for an object that reports throttled requests to the observer in the context, if
+// there is one
+func (c *GoogleClient) getObjectHandle(ctx context.Context, bucketName, objectName string) *storage.ObjectHandle {
+	object := c.getBucketHandle(bucketName).Object(objectName)
+	if observe, ok := ctx.Value(throttleObserverKey{}).(func()); ok {
+		object = object.Retryer(storage.WithErrorFunc(newRetryErrorFunc(observe)))
+	}
+	return object
+}
+
 // ReadObject reads the content of an object from Google Cloud Storage
 func (c *GoogleClient) ReadObject(ctx context.Context, bucketName, objectName string) (io.ReadCloser, error) {
+	return newReader(c.getObjectHandle(ctx, bucketName, objectName).NewReader(ctx))
+}
+
+// ReadObjectCompressed reads an object's content as it is stored, without decompressing objects that were uploaded
+// with Content-Encoding: gzip
+func (c *GoogleClient) ReadObjectCompressed(ctx context.Context, bucketName, objectName string) (io.ReadCloser, error) {
+	return newReader(c.getObjectHandle(ctx, bucketName, objectName).ReadCompressed(true).NewReader(ctx))
+}
+
+// ReadObjectRange reads length bytes of an object's content starting at offset, or the rest of the content if length
+// is negative. If generation is greater than zero, that specific generation of the object is read.
+func (c *GoogleClient) ReadObjectRange(ctx context.Context, bucketName, objectName string, generation, offset, length int64) (io.ReadCloser, error) {
+	object := c.getObjectHandle(ctx, bucketName, objectName)
+	if generation > 0 {
+		object = object.Generation(generation)
+	}
+	return newReader(object.NewRangeReader(ctx, offset, length))
+}
+
+// newReader returns a reader opened by the Google Cloud Storage library, translating its error
+func newReader(reader *storage.Reader, err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return reader, nil
+}
+
+// StatObject gets information about an object in Google Cloud Storage
+func (c *GoogleClient) StatObject(ctx context.Context, bucketName, objectName string) (ObjectInfo, error) {
 	bucket := c.getBucketHandle(bucketName)
-	return bucket.Object(objectName).NewReader(ctx)
+	objAttrs, err := bucket.Object(objectName).Attrs(ctx)
+	if err != nil {
+		return ObjectInfo{}, translateError(err)
+	}
+	return newObjectInfo(objAttrs), nil
+}
+
+// WriteObject creates or replaces an object in Google Cloud Storage with the content of a reader
+func (c *GoogleClient) WriteObject(ctx context.Context, bucketName, objectName string, reader io.Reader, conditions Conditions) (ObjectInfo, error) {
+	bucket := c.getBucketHandle(bucketName)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer := applyConditions(bucket.Object(objectName), conditions).NewWriter(ctx)
+	writer.CRC32C = conditions.CRC32C
+	writer.SendCRC32C = conditions.SendCRC32C
+	if _, err := io.Copy(writer, reader); err != nil {
+		// Cancelling the context before closing the writer aborts the upload
+		cancel()
+		_ = writer.Close()
+		return ObjectInfo{}, translateError(err)
+	}
+	if err := writer.Close(); err != nil {
+		return ObjectInfo{}, translateError(err)
+	}
+	return newObjectInfo(writer.Attrs()), nil
+}
+
+// CopyObject copies an object within Google Cloud Storage, without its content passing through this host. If
+// srcGeneration is greater than zero, that specific generation of the object is copied. Large objects and copies
+// between locations or storage classes take more than one rewrite call, and the library's Copier repeats the call with
+// the rewrite token returned by the previous one until the copy is done.
+func (c *GoogleClient) CopyObject(ctx context.Context, srcBucketName, srcObjectName string, srcGeneration int64, dstBucketName, dstObjectName string) (ObjectInfo, error) {
+	src := c.getBucketHandle(srcBucketName).Object(srcObjectName)
+	if srcGeneration > 0 {
+		src = src.Generation(srcGeneration)
+	}
+	dst := c.getBucketHandle(dstBucketName).Object(dstObjectName)
+	objAttrs, err := dst.CopierFrom(src).Run(ctx)
+	if err != nil {
+		return ObjectInfo{}, translateError(err)
+	}
+	return newObjectInfo(objAttrs), nil
+}
+
+// DeleteObject deletes an object from Google Cloud Storage
+func (c *GoogleClient) DeleteObject(ctx context.Context, bucketName, objectName string, conditions Conditions) error {
+	bucket := c.getBucketHandle(bucketName)
+	return translateError(applyConditions(bucket.Object(objectName), conditions).Delete(ctx))
+}
+
+func applyConditions(object *storage.ObjectHandle, conditions Conditions) *storage.ObjectHandle {
+	if conditions.GenerationMatch == 0 && !conditions.DoesNotExist {
+		return object
+	}
+	return object.If(storage.Conditions{
+		GenerationMatch: conditions.GenerationMatch,
+		DoesNotExist:    conditions.DoesNotExist,
+	})
+}
+
+func newObjectInfo(objAttrs *storage.ObjectAttrs) ObjectInfo {
+	return ObjectInfo{
+		Name:            objAttrs.Name,
+		Size:            objAttrs.Size,
+		Generation:      objAttrs.Generation,
+		Updated:         objAttrs.Updated,
+		CRC32C:          objAttrs.CRC32C,
+		ContentType:     objAttrs.ContentType,
+		ContentEncoding: objAttrs.ContentEncoding,
+	}
+}
+
+// translateError converts errors returned by the Google Cloud Storage library into the errors defined by this package
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %v", ErrObjectNotExist, err)
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %v", ErrPreconditionFailed, err)
+	}
+	return err
+}
+
+// IsThrottlingError returns true if an error indicates that Google Cloud Storage is rate limiting requests or is
+// temporarily unavailable
+func IsThrottlingError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code == http.StatusServiceUnavailable
+	}
+	return false
 }
@@ -20,7 +20,7 @@ import (
 	"bytes"
 	"context"
 	"io"
-	"io/ioutil"
+	"strings"
 )
 
 // MockClient provides a mock implementation of the Client interface
@@ -28,6 +28,10 @@ type MockClient struct {
 	connected                 bool
 	ObjectInfoProviderFunc    func(bucketName, prefix string) []ObjectInfo
 	ObjectContentProviderFunc func(bucketName, objectName string) []byte
+	StatObjectFunc            func(bucketName, objectName string) (ObjectInfo, error)
+	WriteObjectFunc           func(bucketName, objectName string, data []byte, conditions Conditions) (ObjectInfo, error)
+	DeleteObjectFunc          func(bucketName, objectName string, conditions Conditions) error
+	CopyObjectFunc            func(srcBucketName, srcObjectName string, srcGeneration int64, dstBucketName, dstObjectName string) (ObjectInfo, error)
 }
 
 // Connect simulates a connection being established
@@ -42,9 +46,31 @@ func (c *MockClient) Close() error {
 	return nil
 }
 
-// VisitObjects calls a function for each object returned by MockClient.ObjectInfoProviderFunc
-func (c *MockClient) VisitObjects(_ context.Context, bucketName, prefix string, visit func(objectInfo ObjectInfo) error) error {
-	for _, objectInfo := range c.ObjectInfoProviderFunc(bucketName, prefix) {
+// VisitObjects calls a function for each object returned by MockClient.ObjectInfoProviderFunc that matches the
+// query, rolling up objects into prefix entries when the query has a delimiter
+func (c *MockClient) VisitObjects(_ context.Context, bucketName string, query Query, visit func(objectInfo ObjectInfo) error) error {
+	prefixes := map[string]bool{}
+	for _, objectInfo := range c.ObjectInfoProviderFunc(bucketName, query.Prefix) {
+		if !strings.HasPrefix(objectInfo.Name, query.Prefix) {
+			continue
+		}
+		if query.StartOffset != "" && objectInfo.Name < query.StartOffset {
+			continue
+		}
+		if query.EndOffset != "" && objectInfo.Name >= query.EndOffset {
+			continue
+		}
+		if query.Delimiter != "" {
+			rest := strings.TrimPrefix(objectInfo.Name, query.Prefix)
+			if i := strings.Index(rest, query.Delimiter); i >= 0 {
+				prefix := query.Prefix + rest[:i+len(query.Delimiter)]
+				if prefixes[prefix] {
+					continue
+				}
+				prefixes[prefix] = true
+				objectInfo = ObjectInfo{Name: prefix, IsPrefix: true}
+			}
+		}
 		if err := visit(objectInfo); err != nil {
 			return err
 		}
@@ -54,5 +80,48 @@ func (c *MockClient) VisitObjects(_ context.Context, bucketName, prefix string,
 
 // ReadObject returns the data provided by MockClient.ObjectContentProviderFunc
 func (c *MockClient) ReadObject(_ context.Context, bucketName, objectName string) (io.ReadCloser, error) {
-	return ioutil.NopCloser(bytes.NewReader(c.ObjectContentProviderFunc(bucketName, objectName))), nil
+	return io.NopCloser(bytes.NewReader(c.ObjectContentProviderFunc(bucketName, objectName))), nil
+}
+
+// ReadObjectCompressed returns the data provided by MockClient.ObjectContentProviderFunc, which is the data as it is
+// stored
+func (c *MockClient) ReadObjectCompressed(ctx context.Context, bucketName, objectName string) (io.ReadCloser, error) {
+	return c.ReadObject(ctx, bucketName, objectName)
+}
+
+// ReadObjectRange returns a range of the data provided by MockClient.ObjectContentProviderFunc
+func (c *MockClient) ReadObjectRange(_ context.Context, bucketName, objectName string, _, offset, length int64) (io.ReadCloser, error) {
+	data := c.ObjectContentProviderFunc(bucketName, objectName)
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// StatObject returns the information provided by MockClient.StatObjectFunc
+func (c *MockClient) StatObject(_ context.Context, bucketName, objectName string) (ObjectInfo, error) {
+	return c.StatObjectFunc(bucketName, objectName)
+}
+
+// WriteObject reads all data from a reader and passes it to MockClient.WriteObjectFunc
+func (c *MockClient) WriteObject(_ context.Context, bucketName, objectName string, reader io.Reader, conditions Conditions) (ObjectInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return c.WriteObjectFunc(bucketName, objectName, data, conditions)
+}
+
+// CopyObject calls MockClient.CopyObjectFunc
+func (c *MockClient) CopyObject(_ context.Context, srcBucketName, srcObjectName string, srcGeneration int64, dstBucketName, dstObjectName string) (ObjectInfo, error) {
+	return c.CopyObjectFunc(srcBucketName, srcObjectName, srcGeneration, dstBucketName, dstObjectName)
+}
+
+// DeleteObject calls MockClient.DeleteObjectFunc
+func (c *MockClient) DeleteObject(_ context.Context, bucketName, objectName string, conditions Conditions) error {
+	return c.DeleteObjectFunc(bucketName, objectName, conditions)
 }
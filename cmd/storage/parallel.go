@@ -0,0 +1,241 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// splitThreshold is the number of objects that a listing must have for its keyspace to be split into shards, so that
+// small listings, such as most levels of a listing with a maximum depth, don't pay for finding split points
+var splitThreshold = 1000
+
+// maxSplitProbes limits the number of requests made to find the split points for a query
+const maxSplitProbes = 256
+
+// errStopVisiting is returned by a visit function to stop a listing early
+var errStopVisiting = errors.New("stop visiting")
+
+// VisitObjectsParallel splits the keyspace matched by a query into shards using start and end offsets, lists the
+// shards concurrently, and calls a function once for each object found. The keyspace is only split if listing it
+// finds more than splitThreshold objects, and the objects found by that first listing are only visited if it doesn't.
+// Calls to visit are serialized, but the order in which objects are visited is not defined.
+func VisitObjectsParallel(ctx context.Context, client Client, bucketName string, query Query, shards int, visit func(objectInfo ObjectInfo) error) error {
+	if shards <= 1 {
+		return client.VisitObjects(ctx, bucketName, query, visit)
+	}
+
+	// The objects found are not visited until the listing is known to be small, since listing the shards starts over.
+	// Prefix entries can be listed out of name order, so the listing can't be resumed from the last one found.
+	var found []ObjectInfo
+	err := client.VisitObjects(ctx, bucketName, query, func(objectInfo ObjectInfo) error {
+		if len(found) == splitThreshold {
+			return errStopVisiting
+		}
+		found = append(found, objectInfo)
+		return nil
+	})
+	if err == nil {
+		for _, objectInfo := range found {
+			if err := visit(objectInfo); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !errors.Is(err, errStopVisiting) {
+		return err
+	}
+
+	ranges, err := SplitQuery(ctx, client, bucketName, query, shards)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mutex sync.Mutex
+	var firstErr error
+
+	var wg sync.WaitGroup
+	for _, q := range ranges {
+		wg.Add(1)
+		go func(q Query) {
+			defer wg.Done()
+			err := client.VisitObjects(ctx, bucketName, q, func(objectInfo ObjectInfo) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				if firstErr != nil {
+					return firstErr
+				}
+				return visit(objectInfo)
+			})
+			if err != nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mutex.Unlock()
+			}
+		}(q)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// SplitQuery divides the keyspace matched by a query into at most the specified number of non-overlapping queries
+// that together match the same objects as the original query.
+// The split points are prefixes of the names of existing objects. The characters that follow the query's prefix are
+// found by listing the first object at or after a series of offsets, and then the shortest of the prefixes found is
+// expanded the same way, until there are enough of them. This works for flat prefixes, such as dates or IDs, as well
+// as for prefixes with subdirectories. Prefixes are not expanded past the query's delimiter, so that the objects
+// rolled up into a prefix entry are never split between queries.
+func SplitQuery(ctx context.Context, client Client, bucketName string, query Query, shards int) ([]Query, error) {
+	s := &splitter{ctx: ctx, client: client, bucketName: bucketName, query: query}
+	prefixes := []splitPrefix{{name: query.Prefix}}
+	for len(prefixes) < shards && s.probes < maxSplitProbes {
+		i := -1
+		for j, p := range prefixes {
+			if !p.leaf && (i < 0 || len(p.name) < len(prefixes[i].name)) {
+				i = j
+			}
+		}
+		if i < 0 {
+			break
+		}
+		children, err := s.children(prefixes[i].name)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) == 0 {
+			prefixes[i].leaf = true
+			continue
+		}
+		prefixes = append(prefixes[:i], append(children, prefixes[i+1:]...)...)
+	}
+
+	// Each prefix after the first can start a query, so pick the ones that divide the prefixes most evenly
+	var candidates []string
+	for _, p := range prefixes[1:] {
+		if (query.StartOffset == "" || p.name > query.StartOffset) && (query.EndOffset == "" || p.name < query.EndOffset) {
+			candidates = append(candidates, p.name)
+		}
+	}
+	var boundaries []string
+	if pieces := len(candidates) + 1; pieces <= shards {
+		boundaries = candidates
+	} else {
+		for i := 1; i < shards; i++ {
+			boundaries = append(boundaries, candidates[i*pieces/shards-1])
+		}
+	}
+
+	result := make([]Query, 0, len(boundaries)+1)
+	start := query.StartOffset
+	for _, boundary := range boundaries {
+		q := query
+		q.StartOffset = start
+		q.EndOffset = boundary
+		result = append(result, q)
+		start = boundary
+	}
+	q := query
+	q.StartOffset = start
+	result = append(result, q)
+	return result, nil
+}
+
+// splitPrefix is a prefix of the names of existing objects. A leaf is not expanded any further.
+type splitPrefix struct {
+	name string
+	leaf bool
+}
+
+// splitter finds the prefixes that a query can be split at
+type splitter struct {
+	ctx        context.Context
+	client     Client
+	bucketName string
+	query      Query
+	probes     int
+}
+
+// children returns the prefixes that are one character longer than a prefix, in order, for the objects that match the
+// query
+func (s *splitter) children(prefix string) ([]splitPrefix, error) {
+	var children []splitPrefix
+	offset := prefix
+	for s.probes < maxSplitProbes {
+		name, err := s.first(prefix, offset)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+		c, _ := utf8.DecodeRuneInString(name[len(prefix):])
+		child := prefix + string(c)
+		children = append(children, splitPrefix{
+			name: child,
+			leaf: s.query.Delimiter != "" && strings.HasSuffix(child, s.query.Delimiter),
+		})
+
+		// Skip past every name that starts with the child
+		c++
+		if c >= 0xd800 && c < 0xe000 {
+			// Surrogates are not valid in a string
+			c = 0xe000
+		}
+		if c > utf8.MaxRune {
+			break
+		}
+		offset = prefix + string(c)
+	}
+	return children, nil
+}
+
+// first returns the name of the first object that is longer than a prefix and at or after an offset, or an empty
+// string if there isn't one
+func (s *splitter) first(prefix, offset string) (string, error) {
+	s.probes++
+	q := s.query
+	q.Prefix = prefix
+	if offset > q.StartOffset {
+		q.StartOffset = offset
+	}
+	q.PageSize = 1
+
+	var first string
+	err := s.client.VisitObjects(s.ctx, s.bucketName, q, func(objectInfo ObjectInfo) error {
+		if objectInfo.Name == prefix {
+			return nil
+		}
+		first = objectInfo.Name
+		return errStopVisiting
+	})
+	if err != nil && !errors.Is(err, errStopVisiting) {
+		return "", err
+	}
+	return first, nil
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// objectsInQuery returns the names of the objects that match a query, listed the same way as by the Google client
+func objectsInQuery(t *testing.T, client Client, query Query) []string {
+	var names []string
+	err := client.VisitObjects(context.Background(), "bucket", query, func(objectInfo ObjectInfo) error {
+		names = append(names, objectInfo.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestSplitQueryCoversKeyspace(t *testing.T) {
+	var objects []ObjectInfo
+	for _, c := range "!-09AZ_az~" {
+		for i := 0; i < 10; i++ {
+			objects = append(objects, ObjectInfo{Name: fmt.Sprintf("foo/%c%d", c, i)})
+		}
+	}
+	client := &MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []ObjectInfo {
+			return objects
+		},
+	}
+
+	testCases := []struct {
+		query  Query
+		shards int
+	}{
+		{query: Query{Prefix: "foo/"}, shards: 1},
+		{query: Query{Prefix: "foo/"}, shards: 4},
+		{query: Query{Prefix: "foo/"}, shards: 1000},
+		{query: Query{Prefix: "foo/", StartOffset: "foo/b", EndOffset: "foo/x"}, shards: 8},
+		{query: Query{Prefix: "foo/", StartOffset: "foo/a5"}, shards: 8},
+		{query: Query{Prefix: "bar/"}, shards: 8},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%+v in %d shards", tc.query, tc.shards), func(tt *testing.T) {
+			ranges, err := SplitQuery(context.Background(), client, "bucket", tc.query, tc.shards)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if len(ranges) == 0 || len(ranges) > tc.shards {
+				tt.Fatalf("wrong number of ranges: got %d", len(ranges))
+			}
+			if ranges[0].StartOffset != tc.query.StartOffset {
+				tt.Fatalf("wrong first start offset: expected %q, got %q", tc.query.StartOffset, ranges[0].StartOffset)
+			}
+			if ranges[len(ranges)-1].EndOffset != tc.query.EndOffset {
+				tt.Fatalf("wrong last end offset: expected %q, got %q", tc.query.EndOffset, ranges[len(ranges)-1].EndOffset)
+			}
+			for i := 1; i < len(ranges); i++ {
+				if ranges[i].StartOffset != ranges[i-1].EndOffset {
+					tt.Fatalf("ranges are not contiguous: %+v", ranges)
+				}
+				if ranges[i].StartOffset <= ranges[i-1].StartOffset {
+					tt.Fatalf("ranges are not ascending: %+v", ranges)
+				}
+			}
+
+			var count int
+			for _, q := range ranges {
+				count += len(objectsInQuery(tt, client, q))
+			}
+			if expected := len(objectsInQuery(tt, client, tc.query)); count != expected {
+				tt.Fatalf("wrong object count: expected %d, got %d", expected, count)
+			}
+		})
+	}
+}
+
+func TestSplitQueryBalancesFlatPrefixes(t *testing.T) {
+	testCases := map[string]string{
+		"numeric ids": "ids/%08d",
+		"hex ids":     "ids/%06x",
+		"dates":       "logs/2022-01-01T00:%02d:00Z",
+	}
+	for name, format := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var objects []ObjectInfo
+			for i := 0; i < 3600; i++ {
+				if name == "dates" {
+					objects = append(objects, ObjectInfo{Name: fmt.Sprintf(format, i/60) + fmt.Sprintf("-%02d", i%60)})
+				} else {
+					objects = append(objects, ObjectInfo{Name: fmt.Sprintf(format, i)})
+				}
+			}
+			client := &MockClient{
+				ObjectInfoProviderFunc: func(bucketName, prefix string) []ObjectInfo {
+					return objects
+				},
+			}
+
+			query := Query{Prefix: objects[0].Name[:4]}
+			ranges, err := SplitQuery(context.Background(), client, "bucket", query, 4)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if len(ranges) != 4 {
+				tt.Fatalf("wrong number of ranges: expected 4, got %+v", ranges)
+			}
+			for _, q := range ranges {
+				if count := len(objectsInQuery(tt, client, q)); count > len(objects)/2 {
+					tt.Fatalf("range %+v has %d of %d objects", q, count, len(objects))
+				}
+			}
+		})
+	}
+}
+
+func TestVisitObjectsParallelVisitsEachObjectOnce(t *testing.T) {
+	defer func(threshold int) { splitThreshold = threshold }(splitThreshold)
+	splitThreshold = 5
+
+	var objects []ObjectInfo
+	for _, c := range "!-09AZ_az~" {
+		for i := 0; i < 10; i++ {
+			objects = append(objects, ObjectInfo{Name: fmt.Sprintf("prefix/%c%d", c, i)})
+			objects = append(objects, ObjectInfo{Name: fmt.Sprintf("prefix/%c%d/%d", c, i, i)})
+		}
+	}
+	client := &MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []ObjectInfo {
+			return objects
+		},
+	}
+
+	for _, delimiter := range []string{"", PathDelimiter} {
+		query := Query{Prefix: "prefix/", Delimiter: delimiter}
+		expected := objectsInQuery(t, client, query)
+		for _, shards := range []int{1, 2, 7, 64} {
+			t.Run(fmt.Sprintf("delimiter %q in %d shards", delimiter, shards), func(tt *testing.T) {
+				visited := map[string]int{}
+				err := VisitObjectsParallel(context.Background(), client, "bucket", query, shards, func(objectInfo ObjectInfo) error {
+					visited[objectInfo.Name]++
+					return nil
+				})
+				if err != nil {
+					tt.Fatalf("visit failed: %v", err)
+				}
+				if len(visited) != len(expected) {
+					tt.Fatalf("wrong object count: expected %d, got %d", len(expected), len(visited))
+				}
+				for name, count := range visited {
+					if count != 1 {
+						tt.Fatalf("object %s visited %d times", name, count)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestVisitObjectsParallelReturnsVisitError(t *testing.T) {
+	defer func(threshold int) { splitThreshold = threshold }(splitThreshold)
+	splitThreshold = 1
+
+	client := &MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []ObjectInfo {
+			return []ObjectInfo{{Name: "prefix/a"}, {Name: "prefix/m"}, {Name: "prefix/z"}}
+		},
+	}
+	var count int
+	err := VisitObjectsParallel(context.Background(), client, "bucket", Query{Prefix: "prefix/"}, 4, func(objectInfo ObjectInfo) error {
+		count++
+		if count > 1 {
+			return fmt.Errorf("visit failed")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+// pagingClient lists objects in pages the same way as the Google Cloud Storage library, which returns the objects in
+// each page before the prefixes in it
+type pagingClient struct {
+	MockClient
+	pageSize int
+}
+
+func (c *pagingClient) VisitObjects(ctx context.Context, bucketName string, query Query, visit func(objectInfo ObjectInfo) error) error {
+	var entries []ObjectInfo
+	err := c.MockClient.VisitObjects(ctx, bucketName, query, func(objectInfo ObjectInfo) error {
+		entries = append(entries, objectInfo)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	pageSize := c.pageSize
+	if query.PageSize > 0 {
+		pageSize = query.PageSize
+	}
+	for len(entries) > 0 {
+		page := entries
+		if len(page) > pageSize {
+			page = page[:pageSize]
+		}
+		entries = entries[len(page):]
+		for _, isPrefix := range []bool{false, true} {
+			for _, objectInfo := range page {
+				if objectInfo.IsPrefix != isPrefix {
+					continue
+				}
+				if err := visit(objectInfo); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestVisitObjectsParallelVisitsEachEntryOnceWhenPrefixesAreListedAfterObjects(t *testing.T) {
+	defer func(threshold int) { splitThreshold = threshold }(splitThreshold)
+	splitThreshold = 25
+
+	var objects []ObjectInfo
+	for i := 0; i < 100; i++ {
+		objects = append(objects, ObjectInfo{Name: fmt.Sprintf("prefix/%03d", i)})
+		if i%3 == 0 {
+			objects = append(objects, ObjectInfo{Name: fmt.Sprintf("prefix/%03d/nested", i)})
+		}
+	}
+	client := &pagingClient{
+		MockClient: MockClient{
+			ObjectInfoProviderFunc: func(bucketName, prefix string) []ObjectInfo {
+				return objects
+			},
+		},
+		pageSize: 10,
+	}
+
+	query := Query{Prefix: "prefix/", Delimiter: PathDelimiter}
+	expected := objectsInQuery(t, client, query)
+	for _, shards := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d shards", shards), func(tt *testing.T) {
+			visited := map[string]int{}
+			err := VisitObjectsParallel(context.Background(), client, "bucket", query, shards, func(objectInfo ObjectInfo) error {
+				visited[objectInfo.Name]++
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("visit failed: %v", err)
+			}
+			if len(visited) != len(expected) {
+				tt.Fatalf("wrong entry count: expected %d, got %d", len(expected), len(visited))
+			}
+			for name, count := range visited {
+				if count != 1 {
+					tt.Fatalf("entry %s visited %d times", name, count)
+				}
+			}
+		})
+	}
+}
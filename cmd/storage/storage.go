@@ -18,19 +18,70 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
+)
+
+var (
+	// ErrObjectNotExist is returned when an object does not exist
+	ErrObjectNotExist = errors.New("object does not exist")
+	// ErrPreconditionFailed is returned when the conditions of a write or delete are not satisfied
+	ErrPreconditionFailed = errors.New("precondition failed")
 )
 
 // Client defines an interface used to interact with Google Cloud Storage
 type Client interface {
 	Connect(ctx context.Context) error
-	VisitObjects(ctx context.Context, bucketName, prefix string, visit func(objectInfo ObjectInfo) error) error
+	VisitObjects(ctx context.Context, bucketName string, query Query, visit func(objectInfo ObjectInfo) error) error
 	ReadObject(ctx context.Context, bucketName, objectName string) (io.ReadCloser, error)
+	ReadObjectCompressed(ctx context.Context, bucketName, objectName string) (io.ReadCloser, error)
+	ReadObjectRange(ctx context.Context, bucketName, objectName string, generation, offset, length int64) (io.ReadCloser, error)
+	StatObject(ctx context.Context, bucketName, objectName string) (ObjectInfo, error)
+	CopyObject(ctx context.Context, srcBucketName, srcObjectName string, srcGeneration int64, dstBucketName, dstObjectName string) (ObjectInfo, error)
+	WriteObject(ctx context.Context, bucketName, objectName string, reader io.Reader, conditions Conditions) (ObjectInfo, error)
+	DeleteObject(ctx context.Context, bucketName, objectName string, conditions Conditions) error
 	Close() error
 }
 
+// Query specifies which objects are visited by VisitObjects
+type Query struct {
+	// Prefix limits results to objects whose name starts with this value
+	Prefix string
+	// Delimiter, if set, causes objects whose name contains the delimiter after the prefix to be rolled up into a
+	// single prefix entry
+	Delimiter string
+	// StartOffset limits results to objects whose name is lexicographically greater than or equal to this value
+	StartOffset string
+	// EndOffset limits results to objects whose name is lexicographically less than this value
+	EndOffset string
+	// PageSize, if greater than zero, is the number of results requested at a time, so that a listing that is stopped
+	// after the first few results doesn't fetch many more than that
+	PageSize int
+}
+
 // ObjectInfo contains information about an object
 type ObjectInfo struct {
-	Name string
-	Size int64
+	Name       string
+	Size       int64
+	Generation int64
+	Updated    time.Time
+	// CRC32C is the CRC32 checksum of the object's data, using the Castagnoli polynomial
+	CRC32C          uint32
+	ContentType     string
+	ContentEncoding string
+	// IsPrefix indicates that this is a synthetic entry representing a prefix that was rolled up by a delimiter
+	IsPrefix bool
+}
+
+// Conditions are preconditions that must be satisfied for a write or delete to take effect
+type Conditions struct {
+	// GenerationMatch requires the object's current generation to equal this value
+	GenerationMatch int64
+	// DoesNotExist requires that the object does not exist
+	DoesNotExist bool
+	// CRC32C is the checksum that the data of a write must have when SendCRC32C is set, so that data corrupted in
+	// transit is rejected instead of being stored. It is ignored by deletes.
+	CRC32C     uint32
+	SendCRC32C bool
 }
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+type throttleObserverKey struct{}
+
+// WithThrottleObserver returns a context that causes reads made with it to call observe each time a request is
+// throttled. The client retries throttled requests on its own until the context ends, so they are otherwise never
+// seen by the caller.
+func WithThrottleObserver(ctx context.Context, observe func()) context.Context {
+	return context.WithValue(ctx, throttleObserverKey{}, observe)
+}
+
+// newRetryErrorFunc returns a function that decides whether the client retries a failed request, calling observe for
+// each throttled request. It has to replace the client's own decision, so it retries the same errors that the client
+// retries by default.
+func newRetryErrorFunc(observe func()) func(err error) bool {
+	return func(err error) bool {
+		if IsThrottlingError(err) {
+			observe()
+		}
+		return isRetryableError(err)
+	}
+}
+
+// isRetryableError returns true for errors that the Google Cloud Storage library retries by default: 408, 429 and 5xx
+// responses, unexpected EOFs and transient network errors
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusRequestTimeout || apiErr.Code == http.StatusTooManyRequests || (apiErr.Code >= 500 && apiErr.Code < 600)
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && strings.Contains(opErr.Error(), "use of closed network connection") {
+		return true
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		for _, s := range []string{"connection refused", "connection reset"} {
+			if strings.Contains(urlErr.Error(), s) {
+				return true
+			}
+		}
+	}
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
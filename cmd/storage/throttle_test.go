@@ -0,0 +1,56 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestRetryErrorFuncShouldObserveThrottling(t *testing.T) {
+	testCases := map[string]struct {
+		err           error
+		expectedRetry bool
+		expectedCount int
+	}{
+		"nil":               {err: nil},
+		"too many requests": {err: &googleapi.Error{Code: http.StatusTooManyRequests}, expectedRetry: true, expectedCount: 1},
+		"unavailable":       {err: fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusServiceUnavailable}), expectedRetry: true, expectedCount: 1},
+		"internal error":    {err: &googleapi.Error{Code: http.StatusInternalServerError}, expectedRetry: true},
+		"request timeout":   {err: &googleapi.Error{Code: http.StatusRequestTimeout}, expectedRetry: true},
+		"not found":         {err: &googleapi.Error{Code: http.StatusNotFound}},
+		"unexpected eof":    {err: io.ErrUnexpectedEOF, expectedRetry: true},
+		"other error":       {err: errors.New("bad request")},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			count := 0
+			retry := newRetryErrorFunc(func() { count++ })(tc.err)
+			if retry != tc.expectedRetry {
+				tt.Errorf("wrong retry decision: expected %v, got %v", tc.expectedRetry, retry)
+			}
+			if count != tc.expectedCount {
+				tt.Errorf("wrong number of observed throttles: expected %d, got %d", tc.expectedCount, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+const (
+	stripeRoundRobin = "round-robin"
+	stripeFreeSpace  = "free-space"
+	stripeHash       = "hash"
+)
+
+// indexEntry is a line in the index file, recording where an object was saved
+type indexEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// planDirectories assigns each object to one of the output directories, according to --stripe
+func (r *runner) planDirectories(objects []*storage.ObjectInfo) error {
+	if len(r.outputDirectories) <= 1 {
+		return nil
+	}
+
+	r.objectDirectories = map[string]string{}
+	switch r.stripe {
+	case stripeHash:
+		// The same object is always saved to the same directory, even if the set of objects changes between runs
+		for _, obj := range objects {
+			r.objectDirectories[obj.Name] = r.outputDirectories[getShardForObject(obj.Name, len(r.outputDirectories))]
+		}
+	case stripeFreeSpace:
+		reporter, ok := r.copier.(file.SpaceReporter)
+		if !ok {
+			return fmt.Errorf("--stripe %s is not supported for this destination", stripeFreeSpace)
+		}
+		remaining := make([]int64, len(r.outputDirectories))
+		for i, dir := range r.outputDirectories {
+			free, err := reporter.FreeSpace(dir)
+			if err != nil {
+				return fmt.Errorf("failed to get free space for %s: %v", dir, err)
+			}
+			remaining[i] = free
+		}
+
+		// Place the largest objects first, each in the directory with the most space remaining, to keep them balanced
+		bySize := append([]*storage.ObjectInfo{}, objects...)
+		sort.SliceStable(bySize, func(i, j int) bool { return bySize[i].Size > bySize[j].Size })
+		for _, obj := range bySize {
+			best := 0
+			for i := range remaining {
+				if remaining[i] > remaining[best] {
+					best = i
+				}
+			}
+			r.objectDirectories[obj.Name] = r.outputDirectories[best]
+			remaining[best] -= obj.Size
+		}
+	default:
+		for i, obj := range objects {
+			r.objectDirectories[obj.Name] = r.outputDirectories[i%len(r.outputDirectories)]
+		}
+	}
+	return nil
+}
+
+// getDirectoryForObject returns the output directory where an object is saved
+func (r *runner) getDirectoryForObject(name string) string {
+	if dir, ok := r.objectDirectories[name]; ok {
+		return dir
+	}
+	return r.outputDirectory
+}
+
+// writeIndex writes a file with one JSON line for each object, mapping its name to the path where it is saved
+func (r *runner) writeIndex(objects []*storage.ObjectInfo) error {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	for _, obj := range objects {
+		if err := encoder.Encode(indexEntry{Name: obj.Name, Path: r.getPathForObject(obj.Name)}); err != nil {
+			return err
+		}
+	}
+	if _, err := r.copier.CopyToFile(r.indexFile, &buf); err != nil {
+		return fmt.Errorf("failed to write index file: %v", err)
+	}
+	return nil
+}
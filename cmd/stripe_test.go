@@ -0,0 +1,150 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func TestCommandWithMultipleOutputDirectoriesShouldStripeObjects(t *testing.T) {
+	objects := []storage.ObjectInfo{
+		{Name: "prefix/a", Size: 100},
+		{Name: "prefix/b", Size: 10},
+		{Name: "prefix/c", Size: 50},
+		{Name: "prefix/d", Size: 40},
+	}
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			return objects
+		},
+		ObjectContentProviderFunc: func(bucketName, objectName string) []byte {
+			return []byte(objectName)
+		},
+	}
+
+	testCases := map[string]map[string]string{
+		stripeRoundRobin: {"prefix/a": "disk1", "prefix/b": "disk2", "prefix/c": "disk1", "prefix/d": "disk2"},
+		stripeFreeSpace:  {"prefix/a": "disk2", "prefix/b": "disk2", "prefix/c": "disk1", "prefix/d": "disk1"},
+		stripeHash:       {},
+	}
+	for stripe, expected := range testCases {
+		t.Run(stripe, func(tt *testing.T) {
+			mutex := sync.Mutex{}
+			copied := map[string]string{}
+			fileCopier = &file.MockSpaceCopier{
+				MockCopier: file.MockCopier{
+					CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+						b, _ := io.ReadAll(reader)
+						mutex.Lock()
+						defer mutex.Unlock()
+						copied[path] = string(b)
+						return int64(len(b)), nil
+					},
+				},
+				FreeSpaceImplementation: func(path string) (int64, error) {
+					if path == "disk2" {
+						return 1000, nil
+					}
+					return 950, nil
+				},
+				FileSizeImplementation: func(path string) (int64, error) {
+					return 0, nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "disk1", "disk2", "--stripe", stripe})
+			if err := command.Execute(); err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+
+			if stripe == stripeHash {
+				for _, obj := range objects {
+					expected[obj.Name] = []string{"disk1", "disk2"}[getShardForObject(obj.Name, 2)]
+				}
+			}
+
+			index := map[string]string{}
+			scanner := bufio.NewScanner(strings.NewReader(copied[filepath.Join("disk1", ".gsdownload-index.jsonl")]))
+			for scanner.Scan() {
+				var entry indexEntry
+				if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+					tt.Fatalf("invalid index line %q: %v", scanner.Text(), err)
+				}
+				index[entry.Name] = entry.Path
+			}
+
+			for name, dir := range expected {
+				path := filepath.Join(dir, strings.TrimPrefix(name, "prefix/"))
+				if copied[path] != name {
+					tt.Fatalf("expected %s to be saved to %s: %v", name, path, copied)
+				}
+				if index[name] != path {
+					tt.Fatalf("wrong index entry for %s: expected %q, got %q", name, path, index[name])
+				}
+			}
+			if len(index) != len(objects) {
+				tt.Fatalf("wrong number of index entries: expected %d, got %d", len(objects), len(index))
+			}
+		})
+	}
+}
+
+func TestConfigureOutputDirectories(t *testing.T) {
+	testCases := map[string]struct {
+		args              []string
+		stripe            string
+		expectedIndexFile string
+		expectedError     string
+	}{
+		"single directory":     {args: []string{"bucket", "prefix", "path"}},
+		"multiple directories": {args: []string{"bucket", "prefix", "disk1", "disk2"}, expectedIndexFile: filepath.Join("disk1", ".gsdownload-index.jsonl")},
+		"duplicate directory":  {args: []string{"bucket", "prefix", "disk1", "disk1/"}, expectedError: "output directories must be distinct"},
+		"invalid stripe":       {args: []string{"bucket", "prefix", "disk1", "disk2"}, stripe: "random", expectedError: "--stripe must be one of"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			r := runner{stripe: tc.stripe}
+			err := r.configure(NewCommand(), tc.args)
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("configure failed: %v", err)
+			}
+			if !reflect.DeepEqual(r.outputDirectories, tc.args[2:]) {
+				tt.Fatalf("wrong outputDirectories: expected %v, got %v", tc.args[2:], r.outputDirectories)
+			}
+			if r.indexFile != tc.expectedIndexFile {
+				tt.Fatalf("wrong indexFile: expected %q, got %q", tc.expectedIndexFile, r.indexFile)
+			}
+		})
+	}
+}
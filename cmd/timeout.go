@@ -0,0 +1,89 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+var (
+	// retryBaseDelay is the delay before the first retry of an object, which doubles with each subsequent retry
+	retryBaseDelay = time.Second
+	// retryMaxDelay is the maximum delay between retries of an object
+	retryMaxDelay = 30 * time.Second
+)
+
+// objectTimeoutError is returned when reading and writing an object takes longer than --object-timeout
+type objectTimeoutError struct {
+	name    string
+	timeout time.Duration
+}
+
+func (e *objectTimeoutError) Error() string {
+	return fmt.Sprintf("timed out downloading %s after %v", e.name, e.timeout)
+}
+
+// downloadObjectWithRetries downloads an object, retrying if the download times out. Throttled requests are not
+// retried here, because the storage client already retries them until the context ends.
+func (r *runner) downloadObjectWithRetries(ctx context.Context, obj *storage.ObjectInfo) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := r.downloadObjectWithTimeout(ctx, obj)
+		if err == nil || attempt > r.retries || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+
+		if r.verbose {
+			r.logf("%s failed (attempt %d of %d), retrying in %v: %v\n", obj.Name, attempt, r.retries+1, delay, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
+// downloadObjectWithTimeout downloads an object, returning an objectTimeoutError if it takes longer than
+// --object-timeout
+func (r *runner) downloadObjectWithTimeout(ctx context.Context, obj *storage.ObjectInfo) error {
+	if r.objectTimeout <= 0 {
+		return r.downloadObject(ctx, obj)
+	}
+
+	objectCtx, cancel := context.WithTimeout(ctx, r.objectTimeout)
+	defer cancel()
+	err := r.downloadObject(objectCtx, obj)
+	if err != nil && errors.Is(objectCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return &objectTimeoutError{name: obj.Name, timeout: r.objectTimeout}
+	}
+	return err
+}
+
+func isRetryable(err error) bool {
+	var timeoutErr *objectTimeoutError
+	return errors.As(err, &timeoutErr)
+}
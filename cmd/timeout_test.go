@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+// slowClient is a client whose first reads of an object block until their context is done
+type slowClient struct {
+	storage.MockClient
+	mutex     sync.Mutex
+	slowReads int
+	reads     int
+}
+
+func (c *slowClient) ReadObject(ctx context.Context, bucketName, objectName string) (io.ReadCloser, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reads++
+	if c.reads <= c.slowReads {
+		return io.NopCloser(&contextReader{ctx: ctx}), nil
+	}
+	return io.NopCloser(bytes.NewReader([]byte(objectName))), nil
+}
+
+// contextReader blocks until its context is done
+type contextReader struct {
+	ctx context.Context
+}
+
+func (r *contextReader) Read(_ []byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+func TestCommandShouldRetryObjectsThatTimeOut(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = time.Second }()
+
+	testCases := map[string]struct {
+		slowReads     int
+		retries       int
+		expectedError string
+	}{
+		"no timeout":                {},
+		"timeout without retries":   {slowReads: 1, expectedError: "timed out downloading prefix/foo after 20ms"},
+		"timeout with retries":      {slowReads: 2, retries: 2},
+		"timeout exhausted retries": {slowReads: 3, retries: 2, expectedError: "timed out downloading prefix/foo after 20ms"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			client := &slowClient{slowReads: tc.slowReads}
+			client.ObjectInfoProviderFunc = func(bucketName, prefix string) []storage.ObjectInfo {
+				return []storage.ObjectInfo{{Name: "prefix/foo"}}
+			}
+			storageClient = client
+
+			var copied []byte
+			fileCopier = &file.MockCopier{
+				CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+					b, err := io.ReadAll(reader)
+					copied = b
+					return int64(len(b)), err
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs([]string{"bucket", "prefix", "path", "--object-timeout", "20ms", "--retries", strconv.Itoa(tc.retries)})
+			err := command.Execute()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					tt.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			if string(copied) != "prefix/foo" {
+				tt.Fatalf("wrong file contents: got %q", copied)
+			}
+		})
+	}
+}
+
+func TestCommandShouldTimeOutWholeRun(t *testing.T) {
+	client := &slowClient{slowReads: 1}
+	client.ObjectInfoProviderFunc = func(bucketName, prefix string) []storage.ObjectInfo {
+		return []storage.ObjectInfo{{Name: "prefix/foo"}}
+	}
+	storageClient = client
+	fileCopier = &file.MockCopier{
+		CopyToFileImplementation: func(path string, reader io.Reader) (int64, error) {
+			return io.Copy(io.Discard, reader)
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"bucket", "prefix", "path", "--timeout", "20ms"})
+	err := command.Execute()
+	if err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// Longer suffixes must come first so that, for example, "KiB" is not matched as "B"
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// byteSize is a flag value holding a number of bytes, which can be specified with a unit suffix such as 50MiB
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return formatByteSize(int64(*b))
+}
+
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+func (b *byteSize) Type() string {
+	return "size"
+}
+
+// byteRate is a flag value holding a number of bytes per second, such as 50MiB/s
+type byteRate int64
+
+func (b *byteRate) String() string {
+	if *b == 0 {
+		return "0"
+	}
+	return formatByteSize(int64(*b)) + "/s"
+}
+
+func (b *byteRate) Set(s string) error {
+	n, err := parseByteSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return fmt.Errorf("invalid rate %q", s)
+	}
+	*b = byteRate(n)
+	return nil
+}
+
+func (b *byteRate) Type() string {
+	return "rate"
+}
+
+// concurrency is a flag value holding either a number or "auto"
+type concurrency struct {
+	value *int
+	auto  *bool
+}
+
+func (c *concurrency) String() string {
+	if c.auto != nil && *c.auto {
+		return "auto"
+	}
+	if c.value == nil {
+		return "0"
+	}
+	return strconv.Itoa(*c.value)
+}
+
+func (c *concurrency) Set(s string) error {
+	if s == "auto" {
+		*c.auto = true
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("must be a number or auto")
+	}
+	*c.value = n
+	*c.auto = false
+	return nil
+}
+
+func (c *concurrency) Type() string {
+	return "int|auto"
+}
+
+// percentage is a flag value holding a percentage, such as 1%, where the percent sign is optional
+type percentage float64
+
+func (p *percentage) String() string {
+	if *p == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(*p), 'f', -1, 64) + "%"
+}
+
+func (p *percentage) Set(s string) error {
+	n, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || n < 0 || n > 100 || math.IsNaN(n) {
+		return fmt.Errorf("invalid percentage %q", s)
+	}
+	*p = percentage(n)
+	return nil
+}
+
+func (p *percentage) Type() string {
+	return "percent"
+}
+
+// parseByteSize parses a number of bytes with an optional unit suffix, where KiB, MiB, GiB, TiB and their single
+// letter forms are powers of 1024, and KB, MB, GB and TB are powers of 1000
+func parseByteSize(value string) (int64, error) {
+	s := strings.TrimSpace(value)
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if len(s) > len(unit.suffix) && strings.EqualFold(s[len(s)-len(unit.suffix):], unit.suffix) {
+			s = strings.TrimSpace(s[:len(s)-len(unit.suffix)])
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// formatByteSize formats a number of bytes using the largest binary unit that represents it exactly
+func formatByteSize(n int64) string {
+	// The binary units are the first four entries in byteSizeUnits, from smallest to largest
+	for i := 3; i >= 0 && n != 0; i-- {
+		if unit := byteSizeUnits[i]; n%unit.multiplier == 0 {
+			return fmt.Sprintf("%d%s", n/unit.multiplier, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
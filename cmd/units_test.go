@@ -0,0 +1,107 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	testCases := []struct {
+		value       string
+		expected    int64
+		expectError bool
+	}{
+		{value: "0", expected: 0},
+		{value: "1024", expected: 1024},
+		{value: "10B", expected: 10},
+		{value: "1KiB", expected: 1024},
+		{value: "1kb", expected: 1000},
+		{value: "50MiB", expected: 50 << 20},
+		{value: "1.5G", expected: 3 << 29},
+		{value: "2 TB", expected: 2e12},
+		{value: "", expectError: true},
+		{value: "MiB", expectError: true},
+		{value: "-1", expectError: true},
+		{value: "10XB", expectError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(tt *testing.T) {
+			actual, err := parseByteSize(tc.value)
+			if tc.expectError {
+				if err == nil {
+					tt.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("parse failed: %v", err)
+			}
+			if actual != tc.expected {
+				tt.Fatalf("wrong size: expected %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	testCases := map[int64]string{
+		0:       "0",
+		1000:    "1000",
+		1 << 10: "1KiB",
+		3 << 29: "1536MiB",
+		1 << 40: "1TiB",
+	}
+	for n, expected := range testCases {
+		if actual := formatByteSize(n); actual != expected {
+			t.Fatalf("wrong format for %d: expected %q, got %q", n, expected, actual)
+		}
+	}
+}
+
+func TestByteRateSet(t *testing.T) {
+	var rate byteRate
+	if err := rate.Set("50MiB/s"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if rate != 50<<20 {
+		t.Fatalf("wrong rate: expected %d, got %d", 50<<20, rate)
+	}
+	if rate.String() != "50MiB/s" {
+		t.Fatalf("wrong string: expected %q, got %q", "50MiB/s", rate.String())
+	}
+	if err := rate.Set("fast"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPercentageSet(t *testing.T) {
+	var p percentage
+	for value, expected := range map[string]percentage{"1%": 1, "0.5": 0.5, "100%": 100} {
+		if err := p.Set(value); err != nil {
+			t.Fatalf("set %q failed: %v", value, err)
+		}
+		if p != expected {
+			t.Fatalf("wrong percentage for %q: expected %v, got %v", value, expected, p)
+		}
+	}
+	for _, value := range []string{"", "-1%", "101%", "some"} {
+		if err := p.Set(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brianpursley/gsdownload/cmd/file"
+	"github.com/brianpursley/gsdownload/cmd/storage"
+	"github.com/spf13/cobra"
+)
+
+// uploader uploads the files in a local directory to objects beneath a prefix in a bucket, the reverse of runner
+type uploader struct {
+	bucketName     string
+	prefix         string
+	inputDirectory string
+
+	dryRun          bool
+	notFoundIsError bool
+	startAfter      string
+	endBefore       string
+	noRecursive     bool
+	maxDepth        int
+	maxConcurrent   int
+	maxObjects      int
+	maxBytes        byteSize
+	verbose         bool
+}
+
+// localFile is a file that is uploaded to an object
+type localFile struct {
+	path string
+	name string
+	size int64
+}
+
+type uploadResult struct {
+	file *localFile
+	err  error
+}
+
+func newUploadCommand() *cobra.Command {
+	u := uploader{}
+
+	var cmd = &cobra.Command{
+		Use:          "upload <bucket> <prefix> <input directory>",
+		Short:        "Bulk upload files to a Google Cloud Storage bucket",
+		Long:         `Upload the files in a local directory to objects beneath a prefix in a Google Cloud Storage bucket, skipping objects that are already identical`,
+		SilenceUsage: true,
+		RunE:         u.run,
+	}
+
+	cmd.Flags().BoolVar(&u.dryRun, "dry-run", false, "Display a list of the objects that will be uploaded and then exit without uploading them")
+	cmd.Flags().StringVar(&u.startAfter, "start-after", "", "Only upload files whose full object name is lexicographically after this value")
+	cmd.Flags().StringVar(&u.endBefore, "end-before", "", "Only upload files whose full object name is lexicographically before this value")
+	cmd.Flags().BoolVar(&u.noRecursive, "no-recursive", false, "Only upload files directly beneath the input directory (same as --max-depth 1)")
+	cmd.Flags().IntVar(&u.maxDepth, "max-depth", 0, "The maximum number of levels beneath the input directory to upload files from (0=unlimited)")
+	cmd.Flags().IntVar(&u.maxConcurrent, "max-concurrent", 8, "The maximum number of concurrent uploads (0=unlimited)")
+	cmd.Flags().IntVar(&u.maxObjects, "max-objects", 1000, "The maximum number of files to upload (0=unlimited)")
+	cmd.Flags().Var(&u.maxBytes, "max-bytes", "The maximum total size of files to upload, such as 10GiB (0=unlimited)")
+	cmd.Flags().BoolVar(&u.notFoundIsError, "error", false, "Exit with non-zero exit code if no files were found in the input directory")
+	cmd.Flags().BoolVarP(&u.verbose, "verbose", "v", false, "Include additional information about each file that is uploaded")
+
+	return cmd
+}
+
+func (u *uploader) configure(cmd *cobra.Command, args []string) error {
+	if err := cobra.ExactArgs(3)(cmd, args); err != nil {
+		return err
+	}
+
+	u.bucketName = args[0]
+	u.prefix = args[1]
+	u.inputDirectory = args[2]
+
+	if u.maxDepth < 0 {
+		return fmt.Errorf("--max-depth must be greater than or equal to zero")
+	}
+	if u.noRecursive {
+		if u.maxDepth > 1 {
+			return fmt.Errorf("--no-recursive cannot be used with --max-depth greater than one")
+		}
+		u.maxDepth = 1
+	}
+	if u.maxConcurrent < 0 {
+		return fmt.Errorf("--max-concurrent must be greater than or equal to zero")
+	}
+	if u.maxObjects < 0 {
+		return fmt.Errorf("--max-objects must be greater than or equal to zero")
+	}
+	if u.maxBytes < 0 {
+		return fmt.Errorf("--max-bytes must be greater than or equal to zero")
+	}
+	return nil
+}
+
+func (u *uploader) run(cmd *cobra.Command, args []string) error {
+	if err := u.configure(cmd, args); err != nil {
+		return err
+	}
+	return u.upload(cmd.Context())
+}
+
+func (u *uploader) upload(ctx context.Context) error {
+	err := storageClient.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	files, err := u.getFiles()
+	if err != nil {
+		return fmt.Errorf("failed to get files: %v", err)
+	}
+
+	if u.notFoundIsError && len(files) == 0 {
+		return fmt.Errorf("no files found")
+	}
+
+	sem := newSemaphore(u.maxConcurrent)
+	resultChan := make(chan uploadResult, len(files))
+	go func() {
+		for _, f := range files {
+			sem.acquire()
+			go func(f *localFile) {
+				defer sem.release()
+				resultChan <- uploadResult{file: f, err: u.processFile(ctx, f)}
+			}(f)
+		}
+	}()
+
+	for range files {
+		if result := <-resultChan; result.err != nil {
+			return result.err
+		}
+	}
+	return nil
+}
+
+// getFiles walks the input directory and returns the files to upload, sorted by object name
+func (u *uploader) getFiles() ([]*localFile, error) {
+	var files []*localFile
+	var byteCount int64
+	err := filepath.WalkDir(u.inputDirectory, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(u.inputDirectory, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		depth := strings.Count(filepath.ToSlash(rel), "/") + 1
+		if d.IsDir() {
+			if u.maxDepth > 0 && depth >= u.maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			// Links and special files are not uploaded
+			return nil
+		}
+
+		name := u.getObjectNameForPath(rel)
+		if (u.startAfter != "" && name <= u.startAfter) || (u.endBefore != "" && name >= u.endBefore) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, &localFile{path: p, name: name, size: info.Size()})
+		byteCount += info.Size()
+
+		if u.maxObjects > 0 && len(files) > u.maxObjects {
+			return fmt.Errorf("exceeded the maximum number of files")
+		}
+		if u.maxBytes > 0 && byteCount > int64(u.maxBytes) {
+			return fmt.Errorf("exceeded the maximum number of bytes")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// getObjectNameForPath returns the name of the object that a file is uploaded to, given its path relative to the input
+// directory, so that downloading the prefix to the input directory would save the object to the same file
+func (u *uploader) getObjectNameForPath(rel string) string {
+	return strings.TrimPrefix(path.Join(u.prefix, filepath.ToSlash(rel)), "/")
+}
+
+// processFile uploads a file, unless the object already has the same size and checksum
+func (u *uploader) processFile(ctx context.Context, f *localFile) error {
+	if u.dryRun {
+		u.printFile(f, "")
+		return nil
+	}
+
+	crc32c, err := file.CRC32C(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %v", f.path, err)
+	}
+
+	// Only replace the generation of the object that was compared, or create it if it didn't exist, so that an object
+	// changed by someone else in the meantime is not overwritten. The checksum is sent with the data, so that Cloud
+	// Storage rejects the upload if the data it received is different from the file.
+	conditions := storage.Conditions{DoesNotExist: true, CRC32C: crc32c, SendCRC32C: true}
+	existing, err := storageClient.StatObject(ctx, u.bucketName, f.name)
+	if err == nil {
+		if existing.Size == f.size && existing.CRC32C == crc32c {
+			u.printFile(f, "unchanged")
+			return nil
+		}
+		conditions.DoesNotExist = false
+		conditions.GenerationMatch = existing.Generation
+	} else if !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to get object %s: %v", f.name, err)
+	}
+
+	reader, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", f.path, err)
+	}
+	defer reader.Close()
+
+	uploaded, err := storageClient.WriteObject(ctx, u.bucketName, f.name, reader, conditions)
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		return fmt.Errorf("failed to upload %s: object %s was changed by someone else during the upload", f.path, f.name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", f.path, err)
+	}
+	if uploaded.CRC32C != crc32c {
+		return fmt.Errorf("checksum mismatch for %s: expected crc32c %08x, got %08x", f.name, crc32c, uploaded.CRC32C)
+	}
+
+	u.printFile(f, "")
+	return nil
+}
+
+func (u *uploader) printFile(f *localFile, status string) {
+	switch {
+	case u.verbose && status != "":
+		fmt.Printf("%s --> %s (size=%d, %s)\n", f.path, f.name, f.size, status)
+	case u.verbose:
+		fmt.Printf("%s --> %s (size=%d)\n", f.path, f.name, f.size)
+	case status == "":
+		fmt.Printf("%s\n", f.name)
+	}
+}
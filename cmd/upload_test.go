@@ -0,0 +1,218 @@
+/*
+Copyright 2022 Brian Pursley
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brianpursley/gsdownload/cmd/storage"
+)
+
+func writeUploadTestFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCommandShouldUploadFiles(t *testing.T) {
+	dir := writeUploadTestFiles(t, map[string]string{
+		"new.txt":         "new",
+		"same.txt":        "same",
+		"changed.txt":     "changed",
+		"sub/nested.txt":  "nested",
+		"sub/deep/x.txt":  "deep",
+		"zzz/skipped.txt": "skipped",
+	})
+	remote := map[string]storage.ObjectInfo{
+		"prefix/same.txt":    {Name: "prefix/same.txt", Size: 4, Generation: 3, CRC32C: crc32cForTest([]byte("same"))},
+		"prefix/changed.txt": {Name: "prefix/changed.txt", Size: 7, Generation: 5, CRC32C: 1},
+	}
+
+	testCases := map[string]struct {
+		args           []string
+		expectedWrites []string
+	}{
+		"all": {
+			expectedWrites: []string{
+				"prefix/changed.txt=changed generation=5",
+				"prefix/new.txt=new does-not-exist",
+				"prefix/sub/deep/x.txt=deep does-not-exist",
+				"prefix/sub/nested.txt=nested does-not-exist",
+			},
+		},
+		"max depth": {
+			args: []string{"--max-depth", "2"},
+			expectedWrites: []string{
+				"prefix/changed.txt=changed generation=5",
+				"prefix/new.txt=new does-not-exist",
+				"prefix/sub/nested.txt=nested does-not-exist",
+			},
+		},
+		"no recursive": {
+			args: []string{"--no-recursive"},
+			expectedWrites: []string{
+				"prefix/changed.txt=changed generation=5",
+				"prefix/new.txt=new does-not-exist",
+			},
+		},
+		"start after": {
+			args:           []string{"--start-after", "prefix/new.txt"},
+			expectedWrites: []string{"prefix/sub/deep/x.txt=deep does-not-exist", "prefix/sub/nested.txt=nested does-not-exist"},
+		},
+		"dry run": {
+			args: []string{"--dry-run"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var mutex sync.Mutex
+			var writes []string
+			storageClient = &storage.MockClient{
+				StatObjectFunc: func(bucketName, objectName string) (storage.ObjectInfo, error) {
+					if obj, ok := remote[objectName]; ok {
+						return obj, nil
+					}
+					return storage.ObjectInfo{}, storage.ErrObjectNotExist
+				},
+				WriteObjectFunc: func(bucketName, objectName string, data []byte, conditions storage.Conditions) (storage.ObjectInfo, error) {
+					if !conditions.SendCRC32C || conditions.CRC32C != crc32cForTest(data) {
+						tt.Errorf("expected the checksum of %s to be sent with its data, got %+v", objectName, conditions)
+					}
+					condition := "does-not-exist"
+					if !conditions.DoesNotExist {
+						condition = "generation=" + strconv.FormatInt(conditions.GenerationMatch, 10)
+					}
+					mutex.Lock()
+					defer mutex.Unlock()
+					writes = append(writes, objectName+"="+string(data)+" "+condition)
+					return storage.ObjectInfo{Name: objectName, CRC32C: crc32cForTest(data)}, nil
+				},
+			}
+
+			command := NewCommand()
+			command.SetArgs(append([]string{"upload", "bucket", "prefix", dir, "--end-before", "prefix/zzz"}, tc.args...))
+			if err := command.Execute(); err != nil {
+				tt.Fatalf("execute failed: %v", err)
+			}
+			sort.Strings(writes)
+			if strings.Join(writes, ",") != strings.Join(tc.expectedWrites, ",") {
+				tt.Fatalf("wrong writes: expected %q, got %q", tc.expectedWrites, writes)
+			}
+		})
+	}
+}
+
+func TestCommandShouldFailUploadWithChecksumMismatch(t *testing.T) {
+	dir := writeUploadTestFiles(t, map[string]string{"a.txt": "a"})
+	storageClient = &storage.MockClient{
+		StatObjectFunc: func(bucketName, objectName string) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{}, storage.ErrObjectNotExist
+		},
+		WriteObjectFunc: func(bucketName, objectName string, data []byte, conditions storage.Conditions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{Name: objectName, CRC32C: crc32cForTest(data) + 1}, nil
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"upload", "bucket", "prefix", dir})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestCommandShouldFailUploadWhenObjectChanges(t *testing.T) {
+	dir := writeUploadTestFiles(t, map[string]string{"a.txt": "a"})
+	storageClient = &storage.MockClient{
+		StatObjectFunc: func(bucketName, objectName string) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{}, storage.ErrObjectNotExist
+		},
+		WriteObjectFunc: func(bucketName, objectName string, data []byte, conditions storage.Conditions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{}, storage.ErrPreconditionFailed
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"upload", "bucket", "prefix", dir})
+	if err := command.Execute(); err == nil || !strings.Contains(err.Error(), "changed by someone else") {
+		t.Fatalf("expected precondition error, got %v", err)
+	}
+}
+
+func TestGetObjectNameForPath(t *testing.T) {
+	testCases := map[string]string{
+		"":        "a/b.txt",
+		"foo":     "foo/a/b.txt",
+		"foo/":    "foo/a/b.txt",
+		"foo/bar": "foo/bar/a/b.txt",
+	}
+	for prefix, expected := range testCases {
+		u := &uploader{prefix: prefix}
+		if name := u.getObjectNameForPath(filepath.Join("a", "b.txt")); name != expected {
+			t.Errorf("wrong name for prefix %q: expected %q, got %q", prefix, expected, name)
+		}
+	}
+}
+
+func TestConfigureUploadValidation(t *testing.T) {
+	testCases := map[string]*uploader{
+		"negative max depth":      {maxDepth: -1},
+		"no recursive with depth": {noRecursive: true, maxDepth: 2},
+		"negative max concurrent": {maxConcurrent: -1},
+		"negative max objects":    {maxObjects: -1},
+		"negative max bytes":      {maxBytes: -1},
+	}
+	for name, u := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			if err := u.configure(newUploadCommand(), []string{"bucket", "prefix", "path"}); err == nil {
+				tt.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestCommandShouldDownloadFromBucketNamedUploadAfterDoubleDash(t *testing.T) {
+	var buckets []string
+	storageClient = &storage.MockClient{
+		ObjectInfoProviderFunc: func(bucketName, prefix string) []storage.ObjectInfo {
+			buckets = append(buckets, bucketName)
+			return nil
+		},
+	}
+
+	command := NewCommand()
+	command.SetArgs([]string{"--dry-run", "--", "upload", "prefix", "path"})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if strings.Join(buckets, ",") != "upload" {
+		t.Fatalf("expected objects to be listed from bucket upload, got %v", buckets)
+	}
+}
@@ -1,9 +1,12 @@
 module github.com/brianpursley/gsdownload
 
-go 1.17
+go 1.22
 
 require (
 	cloud.google.com/go/storage v1.20.0
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/cobra v1.3.0
+	golang.org/x/sys v0.0.0-20220204135822-1c1b9b1eba6a
 	google.golang.org/api v0.68.0
 )
 
@@ -16,12 +19,10 @@ require (
 	github.com/google/go-cmp v0.5.7 // indirect
 	github.com/googleapis/gax-go/v2 v2.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
-	github.com/spf13/cobra v1.3.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	go.opencensus.io v0.23.0 // indirect
 	golang.org/x/net v0.0.0-20210813160813-60bc85c4be6d // indirect
 	golang.org/x/oauth2 v0.0.0-20211104180415-d3ed0bb246c8 // indirect
-	golang.org/x/sys v0.0.0-20220204135822-1c1b9b1eba6a // indirect
 	golang.org/x/text v0.3.7 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	google.golang.org/appengine v1.6.7 // indirect